@@ -0,0 +1,21 @@
+package bus
+
+// Handler receives topic messages delivered by the bus.
+type Handler func(topic string, payload []byte)
+
+// Bus is used by the server to publish topic messages. Implementation
+// delivers published messages to the handlers of every node, including the
+// node that published it. Delivery guarantees between nodes depend on the
+// implementation, see TCP.
+type Bus interface {
+	// Publish sends payload to all nodes subscribed to the bus. Returns
+	// error only when payload was not delivered anywhere, so it can be
+	// published again without delivering it twice.
+	Publish(topic string, payload []byte) error
+
+	// Subscribe adds handler that receives messages published on the bus.
+	Subscribe(handler Handler)
+
+	// Close stops the bus and releases its resources.
+	Close() error
+}
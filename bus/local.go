@@ -0,0 +1,37 @@
+package bus
+
+import "sync"
+
+// Local is in-process Bus implementation. It delivers published messages
+// only to handlers subscribed in the same process.
+type Local struct {
+	handlers []Handler
+	lock     sync.RWMutex
+}
+
+// Creates new in-process bus
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Delivers payload to all subscribed handlers
+func (b *Local) Publish(topic string, payload []byte) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, h := range b.handlers {
+		h(topic, payload)
+	}
+	return nil
+}
+
+// Adds handler that receives published messages
+func (b *Local) Subscribe(handler Handler) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Local bus does not hold any resources
+func (b *Local) Close() error {
+	return nil
+}
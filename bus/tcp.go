@@ -0,0 +1,521 @@
+package bus
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultPeerQueueSize = 1024
+
+	dialTimeout  = time.Second * 3
+	writeTimeout = time.Second * 5
+
+	// Time for a peer to send its hello after connecting
+	helloTimeout = time.Second * 5
+
+	// Delays between reconnect attempts to a peer
+	minRetryDelay = time.Millisecond * 100
+	maxRetryDelay = time.Second * 5
+)
+
+var (
+	ErrBusClosed     = errors.New("bus is closed")
+	ErrQueueFull     = errors.New("peer queue is full")
+	ErrInvalidSecret = errors.New("invalid bus secret")
+)
+
+// Message frame sent between nodes. ID is increasing sequence number of
+// the sending node.
+type frame struct {
+	ID      uint64 `json:"id"`
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// First frame sent on every connection to a peer. Node identifies sending
+// process and is used to drop messages delivered before.
+type hello struct {
+	Node   string `json:"node"`
+	Secret string `json:"secret"`
+}
+
+// Answer to hello. Error is set when peer rejected the connection.
+type welcome struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Acknowledges that all frames up to ID were delivered
+type ack struct {
+	ID uint64 `json:"ack"`
+}
+
+// TCPConfig holds settings of TCP bus
+type TCPConfig struct {
+	// Address to listen on, i.e. "10.0.0.1:7001"
+	Addr string
+
+	// Addresses of other nodes
+	Peers []string
+
+	// Shared secret every node must send when connecting. Connections with
+	// different secret are rejected with ErrInvalidSecret. Empty secret
+	// accepts any node that can reach the listener, so listen on a private
+	// network in that case.
+	Secret string
+
+	// Number of messages waiting to be written to a single peer and number
+	// of written messages waiting for acknowledgement. When the queue is
+	// full the message is not sent to that peer and is reported with
+	// OnUndelivered. Default is DefaultPeerQueueSize.
+	PeerQueueSize int
+
+	// Called with every message that will not be delivered to the peer:
+	// with ErrQueueFull when its queue is full and with ErrBusClosed for
+	// messages the peer did not acknowledge before the bus was closed.
+	OnUndelivered func(peer, topic string, payload []byte, err error)
+
+	// Called when connection to a peer fails or is rejected (i.e.
+	// ErrInvalidSecret) and when the listener rejects a node. Messages stay
+	// queued and are retried.
+	OnPeerError func(peer string, err error)
+}
+
+// TCP is a reference Bus implementation for multiple nodes. Every node
+// listens on its own address and keeps connections to all of its peers
+// (full mesh). Published message is delivered to local handlers and queued
+// once for every peer, peers deliver it only to their local handlers and
+// never forward it.
+//
+// Every peer has its own writer gorutine, so a slow or unreachable peer
+// does not delay Publish or other peers. Peer acknowledges every message
+// it delivered. Writer reconnects and writes unacknowledged messages again
+// and the peer drops the ones it has already delivered, so every message
+// is delivered exactly once to every peer unless it is reported with
+// OnUndelivered.
+//
+// Listener accepts messages from any node that sends the configured Secret.
+// Without Secret anyone who can connect can publish.
+/*
+	// Node A
+	a, _ := bus.NewTCPConfig(bus.TCPConfig{Addr: "10.0.0.1:7001", Peers: []string{"10.0.0.2:7001"}, Secret: secret})
+	serverA.SetBus(a)
+
+	// Node B
+	b, _ := bus.NewTCPConfig(bus.TCPConfig{Addr: "10.0.0.2:7001", Peers: []string{"10.0.0.1:7001"}, Secret: secret})
+	serverB.SetBus(b)
+*/
+type TCP struct {
+	config   TCPConfig
+	local    *Local
+	listener net.Listener
+
+	// Random id of this node and sequence of published messages
+	node string
+	seq  uint64
+
+	peers    []*peer
+	peerLock sync.RWMutex
+
+	// Accepted connections from other nodes
+	conns    map[net.Conn]struct{}
+	connLock sync.Mutex
+
+	// Last delivered message id of every node that connected
+	delivered     map[string]uint64
+	deliveredLock sync.Mutex
+
+	exit      chan interface{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Creates new TCP bus listening on addr and publishing to given peers.
+// Nodes do not use a shared secret.
+func NewTCP(addr string, peers ...string) (*TCP, error) {
+	return NewTCPConfig(TCPConfig{Addr: addr, Peers: peers})
+}
+
+// Creates new TCP bus with provided config
+func NewTCPConfig(config TCPConfig) (*TCP, error) {
+	if config.PeerQueueSize <= 0 {
+		config.PeerQueueSize = DefaultPeerQueueSize
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &TCP{
+		config:    config,
+		local:     NewLocal(),
+		listener:  l,
+		node:      hex.EncodeToString(id),
+		conns:     make(map[net.Conn]struct{}),
+		delivered: make(map[string]uint64),
+		exit:      make(chan interface{}),
+	}
+	for _, p := range config.Peers {
+		b.AddPeer(p)
+	}
+	go b.accept()
+	return b, nil
+}
+
+// Address the bus is listening on
+func (b *TCP) Addr() net.Addr {
+	return b.listener.Addr()
+}
+
+// Adds peer node address and starts its writer. Connection is established
+// on first publish.
+func (b *TCP) AddPeer(addr string) {
+	b.peerLock.Lock()
+	defer b.peerLock.Unlock()
+	select {
+	case <-b.exit:
+		return
+	default:
+	}
+	p := &peer{
+		addr:  addr,
+		bus:   b,
+		queue: make(chan *frame, b.config.PeerQueueSize),
+	}
+	b.peers = append(b.peers, p)
+	b.wg.Add(1)
+	go p.goWrite()
+}
+
+// Delivers payload to local handlers and queues it for every peer. Returns
+// error only when the bus is closed and payload was not delivered anywhere.
+// Peers whose queue is full are reported with OnUndelivered.
+func (b *TCP) Publish(topic string, payload []byte) error {
+	select {
+	case <-b.exit:
+		return ErrBusClosed
+	default:
+	}
+	b.local.Publish(topic, payload)
+	f := &frame{ID: atomic.AddUint64(&b.seq, 1), Topic: topic, Payload: payload}
+
+	b.peerLock.RLock()
+	defer b.peerLock.RUnlock()
+	closed := false
+	select {
+	case <-b.exit:
+		// Closed after local delivery, writers do not take messages anymore
+		closed = true
+	default:
+	}
+	for _, p := range b.peers {
+		if closed {
+			b.undelivered(p.addr, f, ErrBusClosed)
+			continue
+		}
+		select {
+		case p.queue <- f:
+		default:
+			b.undelivered(p.addr, f, ErrQueueFull)
+		}
+	}
+	return nil
+}
+
+// Adds handler that receives messages from this and peer nodes
+func (b *TCP) Subscribe(handler Handler) {
+	b.local.Subscribe(handler)
+}
+
+// Stops listening, stops peer writers and closes all connections. Messages
+// not yet acknowledged by peers are reported with OnUndelivered.
+func (b *TCP) Close() error {
+	err := ErrBusClosed
+	b.closeOnce.Do(func() {
+		b.peerLock.Lock()
+		close(b.exit)
+		b.peerLock.Unlock()
+		err = b.listener.Close()
+		b.connLock.Lock()
+		for c := range b.conns {
+			c.Close()
+		}
+		b.connLock.Unlock()
+		b.wg.Wait()
+	})
+	return err
+}
+
+// Reports message that will not be delivered to the peer
+func (b *TCP) undelivered(addr string, f *frame, err error) {
+	if b.config.OnUndelivered != nil {
+		b.config.OnUndelivered(addr, f.Topic, f.Payload, err)
+	}
+}
+
+// Reports failed or rejected connection
+func (b *TCP) peerError(addr string, err error) {
+	if b.config.OnPeerError != nil {
+		b.config.OnPeerError(addr, err)
+	}
+}
+
+// Accepts connections from peers
+func (b *TCP) accept() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			select {
+			case <-b.exit:
+				return
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		b.connLock.Lock()
+		b.conns[c] = struct{}{}
+		b.connLock.Unlock()
+		go b.read(c)
+	}
+}
+
+// Checks hello of peer connection, then reads frames from it, delivers
+// them to local handlers and acknowledges them
+func (b *TCP) read(c net.Conn) {
+	defer func() {
+		b.connLock.Lock()
+		delete(b.conns, c)
+		b.connLock.Unlock()
+		c.Close()
+	}()
+	dec := json.NewDecoder(c)
+	enc := json.NewEncoder(c)
+	h := hello{}
+	c.SetReadDeadline(time.Now().Add(helloTimeout))
+	if err := dec.Decode(&h); err != nil {
+		return
+	}
+	c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if subtle.ConstantTimeCompare([]byte(h.Secret), []byte(b.config.Secret)) != 1 {
+		b.peerError(c.RemoteAddr().String(), ErrInvalidSecret)
+		enc.Encode(welcome{Error: ErrInvalidSecret.Error()})
+		return
+	}
+	if err := enc.Encode(welcome{}); err != nil {
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+	for {
+		f := frame{}
+		if err := dec.Decode(&f); err != nil {
+			return
+		}
+		if b.isNew(h.Node, f.ID) {
+			b.local.Publish(f.Topic, f.Payload)
+		}
+		c.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := enc.Encode(ack{ID: f.ID}); err != nil {
+			return
+		}
+	}
+}
+
+// Returns true and remembers id when message of the node was not delivered
+// before. Ids of a node are increasing.
+func (b *TCP) isNew(node string, id uint64) bool {
+	b.deliveredLock.Lock()
+	defer b.deliveredLock.Unlock()
+	if id <= b.delivered[node] {
+		return false
+	}
+	b.delivered[node] = id
+	return true
+}
+
+// Outgoing connection to a peer node
+type peer struct {
+	addr  string
+	bus   *TCP
+	queue chan *frame
+
+	// Written messages waiting for acknowledgement in sending order
+	pending []*frame
+
+	conn net.Conn
+	acks chan uint64
+	lost chan struct{}
+	stop chan struct{}
+}
+
+// gorutine writing queued messages to the peer until the bus is closed.
+// Connection is (re)established when needed and unacknowledged messages
+// are written again.
+func (p *peer) goWrite() {
+	defer p.bus.wg.Done()
+	defer p.close()
+	delay := minRetryDelay
+	for {
+		if p.conn == nil {
+			if err := p.connect(); err != nil {
+				p.bus.peerError(p.addr, err)
+				select {
+				case <-time.After(delay):
+				case <-p.bus.exit:
+					p.drop()
+					return
+				}
+				if delay *= 2; delay > maxRetryDelay {
+					delay = maxRetryDelay
+				}
+				continue
+			}
+			delay = minRetryDelay
+		}
+		// Stop taking new messages while too many wait for acknowledgement
+		queue := p.queue
+		if len(p.pending) >= cap(p.queue) {
+			queue = nil
+		}
+		select {
+		case f := <-queue:
+			p.pending = append(p.pending, f)
+			if err := p.write(f); err != nil {
+				p.close()
+			}
+		case id := <-p.acks:
+			p.acknowledge(id)
+		case <-p.lost:
+			p.close()
+		case <-p.bus.exit:
+			p.drop()
+			return
+		}
+	}
+}
+
+// Removes acknowledged messages from pending
+func (p *peer) acknowledge(id uint64) {
+	n := 0
+	for n < len(p.pending) && p.pending[n].ID <= id {
+		n++
+	}
+	p.pending = p.pending[n:]
+}
+
+// Reports pending and queued messages as undelivered after the bus was
+// closed. Publish does not queue messages after that.
+func (p *peer) drop() {
+	for _, f := range p.pending {
+		p.bus.undelivered(p.addr, f, ErrBusClosed)
+	}
+	p.pending = nil
+	for {
+		select {
+		case f := <-p.queue:
+			p.bus.undelivered(p.addr, f, ErrBusClosed)
+		default:
+			return
+		}
+	}
+}
+
+// Writes single frame to the connection
+func (p *peer) write(f *frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = p.conn.Write(append(data, '\n'))
+	return err
+}
+
+// Connects to the peer, sends hello, waits for welcome and writes pending
+// messages again
+func (p *peer) connect() error {
+	c, err := net.DialTimeout("tcp", p.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(hello{Node: p.bus.node, Secret: p.bus.config.Secret})
+	if err != nil {
+		c.Close()
+		return err
+	}
+	c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.Write(append(data, '\n')); err != nil {
+		c.Close()
+		return err
+	}
+	dec := json.NewDecoder(c)
+	w := welcome{}
+	c.SetReadDeadline(time.Now().Add(helloTimeout))
+	if err := dec.Decode(&w); err != nil {
+		c.Close()
+		return err
+	}
+	if w.Error == ErrInvalidSecret.Error() {
+		c.Close()
+		return ErrInvalidSecret
+	}
+	if w.Error != "" {
+		c.Close()
+		return fmt.Errorf("peer rejected connection: %s", w.Error)
+	}
+	c.SetReadDeadline(time.Time{})
+	p.conn = c
+	// Never more acknowledgements than pending messages, so reader does not block
+	p.acks = make(chan uint64, cap(p.queue))
+	p.lost = make(chan struct{})
+	p.stop = make(chan struct{})
+	go p.readAcks(dec, p.acks, p.lost, p.stop)
+	for _, f := range p.pending {
+		if err := p.write(f); err != nil {
+			p.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads acknowledgements of a connection until it fails or is closed
+func (p *peer) readAcks(dec *json.Decoder, acks chan<- uint64, lost, stop chan struct{}) {
+	defer close(lost)
+	for {
+		a := ack{}
+		if err := dec.Decode(&a); err != nil {
+			return
+		}
+		select {
+		case acks <- a.ID:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Closes connection to the peer
+func (p *peer) close() {
+	if p.conn != nil {
+		close(p.stop)
+		p.conn.Close()
+		p.conn = nil
+		p.acks = nil
+		p.lost = nil
+	}
+}
@@ -0,0 +1,390 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Collects messages received by a node
+type inbox struct {
+	messages map[string]int
+	lock     sync.Mutex
+}
+
+func newInbox(b Bus) *inbox {
+	in := &inbox{messages: map[string]int{}}
+	b.Subscribe(func(topic string, payload []byte) {
+		in.lock.Lock()
+		defer in.lock.Unlock()
+		in.messages[topic+":"+string(payload)]++
+	})
+	return in
+}
+
+// Waits until inbox has expected messages, each received once
+func (in *inbox) expect(t *testing.T, node int, expected []string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		in.lock.Lock()
+		complete := len(in.messages) == len(expected)
+		for _, msg := range expected {
+			complete = complete && in.messages[msg] == 1
+		}
+		got := fmt.Sprint(in.messages)
+		in.lock.Unlock()
+		if complete {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %d: got %s, expected each of %v once", node, got, expected)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// Collects messages reported as undelivered
+type undelivered struct {
+	messages map[string]error
+	lock     sync.Mutex
+}
+
+func newUndelivered() *undelivered {
+	return &undelivered{messages: map[string]error{}}
+}
+
+func (u *undelivered) add(peer, topic string, payload []byte, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.messages[topic+":"+string(payload)] = err
+}
+
+func (u *undelivered) get() map[string]error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	messages := map[string]error{}
+	for k, v := range u.messages {
+		messages[k] = v
+	}
+	return messages
+}
+
+// Forwards connections to target node. Connections can be broken and
+// acknowledgements sent back dropped to simulate network failures.
+type proxy struct {
+	listener net.Listener
+	target   string
+	drop     int32
+	conns    []net.Conn
+	count    int
+	lock     sync.Mutex
+}
+
+func newProxy(t *testing.T, target string) *proxy {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &proxy{listener: l, target: target}
+	t.Cleanup(func() {
+		l.Close()
+		p.breakConns()
+	})
+	go p.serve()
+	return p
+}
+
+func (p *proxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *proxy) serve() {
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		target, err := net.Dial("tcp", p.target)
+		if err != nil {
+			c.Close()
+			continue
+		}
+		p.lock.Lock()
+		p.conns = append(p.conns, c, target)
+		p.count++
+		p.lock.Unlock()
+		go io.Copy(target, c)
+		go p.copyBack(c, target)
+	}
+}
+
+// Copies data from target to the node unless it is dropped
+func (p *proxy) copyBack(dst, src net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		if atomic.LoadInt32(&p.drop) == 1 {
+			continue
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func (p *proxy) dropAcks(drop bool) {
+	if drop {
+		atomic.StoreInt32(&p.drop, 1)
+	} else {
+		atomic.StoreInt32(&p.drop, 0)
+	}
+}
+
+// Closes all forwarded connections
+func (p *proxy) breakConns() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+// Number of accepted connections
+func (p *proxy) accepted() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.count
+}
+
+// Returns free loopback address
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// Starts full mesh of nodes on loopback addresses
+func newMesh(t *testing.T, secrets ...string) []*TCP {
+	t.Helper()
+	nodes := make([]*TCP, len(secrets))
+	for i, secret := range secrets {
+		b, err := NewTCPConfig(TCPConfig{Addr: "127.0.0.1:0", Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { b.Close() })
+		nodes[i] = b
+	}
+	for i, b := range nodes {
+		for j, other := range nodes {
+			if i != j {
+				b.AddPeer(other.Addr().String())
+			}
+		}
+	}
+	return nodes
+}
+
+func TestTCPDeliversToEveryNodeOnce(t *testing.T) {
+	nodes := newMesh(t, "secret", "secret", "secret")
+	inboxes := []*inbox{}
+	for _, b := range nodes {
+		inboxes = append(inboxes, newInbox(b))
+	}
+	expected := []string{}
+	for i, b := range nodes {
+		for j := 0; j < 10; j++ {
+			payload := fmt.Sprintf("%d-%d", i, j)
+			if err := b.Publish("orders", []byte(payload)); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, "orders:"+payload)
+		}
+	}
+	for i, in := range inboxes {
+		in.expect(t, i, expected)
+	}
+}
+
+func TestTCPRejectsWrongSecret(t *testing.T) {
+	listenerErrs, peerErrs := make(chan error, 100), make(chan error, 100)
+	lost := newUndelivered()
+	trusted, err := NewTCPConfig(TCPConfig{
+		Addr:        "127.0.0.1:0",
+		Secret:      "secret",
+		OnPeerError: func(peer string, err error) { listenerErrs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trusted.Close()
+	intruder, err := NewTCPConfig(TCPConfig{
+		Addr:          "127.0.0.1:0",
+		Peers:         []string{trusted.Addr().String()},
+		Secret:        "other",
+		OnUndelivered: lost.add,
+		OnPeerError:   func(peer string, err error) { peerErrs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := newInbox(trusted)
+	if err := intruder.Publish("orders", []byte("fake")); err != nil {
+		t.Fatal(err)
+	}
+	for name, errs := range map[string]chan error{"listener": listenerErrs, "peer": peerErrs} {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrInvalidSecret) {
+				t.Fatalf("%s: unexpected error %v", name, err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("%s did not notice wrong secret", name)
+		}
+	}
+	// Message is kept until the bus is closed and then reported
+	intruder.Close()
+	if got := lost.get(); len(got) != 1 || got["orders:fake"] != ErrBusClosed {
+		t.Fatalf("unexpected undelivered messages %v", got)
+	}
+	if err := trusted.Publish("orders", []byte("real")); err != nil {
+		t.Fatal(err)
+	}
+	in.expect(t, 0, []string{"orders:real"})
+}
+
+func TestTCPRedeliversAfterBrokenConnection(t *testing.T) {
+	b, err := NewTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	in := newInbox(b)
+	px := newProxy(t, b.Addr().String())
+	a, err := NewTCP("127.0.0.1:0", px.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	expected := []string{}
+	publish := func(from, to int) {
+		for i := from; i < to; i++ {
+			payload := fmt.Sprint(i)
+			if err := a.Publish("orders", []byte(payload)); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, "orders:"+payload)
+		}
+	}
+	publish(0, 5)
+	in.expect(t, 1, expected)
+
+	// Peer delivers messages but acknowledgements are lost with the
+	// connection, so they are written again after reconnect
+	px.dropAcks(true)
+	publish(5, 10)
+	in.expect(t, 1, expected)
+	px.dropAcks(false)
+	px.breakConns()
+
+	publish(10, 15)
+	in.expect(t, 1, expected)
+	if px.accepted() < 2 {
+		t.Fatal("expected reconnect")
+	}
+}
+
+func TestTCPReportsFullQueue(t *testing.T) {
+	addr := freeAddr(t)
+	lost := newUndelivered()
+	a, err := NewTCPConfig(TCPConfig{Addr: "127.0.0.1:0", Peers: []string{addr}, PeerQueueSize: 2, OnUndelivered: lost.add})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	local := newInbox(a)
+	published := []string{}
+	for i := 0; i < 10; i++ {
+		payload := fmt.Sprint(i)
+		// Local delivery succeeded, so publish must not ask for a retry
+		if err := a.Publish("orders", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, "orders:"+payload)
+	}
+	local.expect(t, 0, published)
+
+	reported := lost.get()
+	if len(reported) == 0 {
+		t.Fatal("expected messages over the queue size to be reported")
+	}
+	expected := []string{}
+	for _, msg := range published {
+		if err, ok := reported[msg]; !ok {
+			expected = append(expected, msg)
+		} else if err != ErrQueueFull {
+			t.Fatalf("%s: unexpected error %v", msg, err)
+		}
+	}
+	b, err := NewTCP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	// Every message is either reported or delivered
+	newInbox(b).expect(t, 1, expected)
+}
+
+func TestTCPRetriesUntilPeerIsUp(t *testing.T) {
+	addr := freeAddr(t)
+	a, err := NewTCP("127.0.0.1:0", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if err := a.Publish("orders", []byte("early")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(minRetryDelay * 2)
+
+	b, err := NewTCP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	newInbox(b).expect(t, 1, []string{"orders:early"})
+}
+
+func TestTCPPublishDoesNotWaitForPeers(t *testing.T) {
+	// Nothing listens on the peer address
+	a, err := NewTCPConfig(TCPConfig{Addr: "127.0.0.1:0", Peers: []string{freeAddr(t)}, PeerQueueSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := a.Publish("orders", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("publish took %s", elapsed)
+	}
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/registry"
+	"github.com/kroksys/jrpc/spec"
+	"github.com/kroksys/pool"
+)
+
+// Error returned by the server in a response
+type Error struct {
+	Code    spec.ErrorCode
+	Message spec.ErrorMsg
+	Data    interface{}
+}
+
+// Converts json-rpc error object to Error
+func newError(e *spec.Error) *Error {
+	return &Error{Code: e.Code, Message: e.Message, Data: e.Data}
+}
+
+func (e *Error) Error() string {
+	if e.Data != nil {
+		return fmt.Sprintf("jrpc error %d: %s: %v", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("jrpc error %d: %s", e.Code, e.Message)
+}
+
+// Client is a json-rpc client using websockets. Besides calling server
+// methods it can serve methods the server calls on it when Registry is set.
+type Client struct {
+	// Connection to the server
+	Conn *conn.Conn
+
+	// Flag to turn on/off logs for client
+	LogsOn bool
+
+	// Logger used when logs are turned on
+	Logger registry.Logger
+
+	// Codec used to decode incoming and encode outgoing messages
+	Codec spec.Codec
+
+	// Registry serving requests and notifications sent by the server.
+	// When nil server requests are answered with method not found error.
+	Registry *registry.Registry
+
+	// Headers sent with upgrade request
+	Header http.Header
+
+	// Subprotocols requested during upgrade in preferred order
+	Subprotocols []string
+
+	// Settings of the connection (write deadline, queue size, request timeout)
+	ConnConfig conn.Config
+
+	// Active subscriptions by request ID
+	subscriptions *pool.PoolStr[*Subscription]
+	lastSubID     uint64
+}
+
+// Connects to jrpc server at websocket url (ws:// or wss://) and starts
+// handling incoming messages.
+/*
+	c, err := client.Dial(ctx, "ws://localhost:3333/ws")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	var out int
+	err = c.Call(ctx, "example.Simple", []interface{}{1, 2}, &out)
+*/
+func Dial(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	c, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	dialer := ws.Dialer{
+		Protocols: c.Subprotocols,
+	}
+	if len(c.Header) > 0 {
+		dialer.Header = ws.HandshakeHeaderHTTP(c.Header)
+	}
+	cn, br, _, err := dialer.Dial(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	// Server may have sent frames right after handshake
+	c.start(conn.Buffered(cn, br))
+	return c, nil
+}
+
+// Creates client using websocket connection that is already established,
+// i.e. one side of net.Pipe in tests, and starts handling incoming messages.
+// Header and Subprotocols are not used.
+func New(cn net.Conn, opts ...Option) (*Client, error) {
+	c, err := newClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	c.start(cn)
+	return c, nil
+}
+
+// Creates client with default settings and applies options
+func newClient(opts []Option) (*Client, error) {
+	c := &Client{
+		Logger:        log.Default(),
+		Codec:         spec.DefaultCodec,
+		ConnConfig:    conn.DefaultConfig(),
+		subscriptions: pool.NewPoolStr[*Subscription](),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	c.ConnConfig.Codec = c.Codec
+	return c, nil
+}
+
+// Wraps websocket connection and starts handling incoming messages
+func (c *Client) start(cn net.Conn) {
+	c.Conn = conn.NewClientConn(cn, c.ConnConfig)
+	go c.goHandle()
+}
+
+// Calls server method and decodes its result into result. Result can be
+// nil when it is not needed. Error returned by the server is *Error.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	resp, err := c.Conn.Request(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return newError(resp.Error)
+	}
+	return c.decode(resp.Result, result)
+}
+
+// Call sent in a batch. Result is decoded into Result when it is not nil,
+// error returned by the server is set to Error.
+type BatchCall struct {
+	Method string
+	Params interface{}
+	Result interface{}
+	Error  error
+}
+
+// Sends calls as one batch request and waits for all responses. Returned
+// error is set when the batch could not be sent or answered, errors of
+// single calls are in BatchCall.Error.
+/*
+	calls := []client.BatchCall{
+		{Method: "example.Simple", Params: []interface{}{1, 2}, Result: &a},
+		{Method: "example.Simple", Params: []interface{}{3, 4}, Result: &b},
+	}
+	err := c.Batch(ctx, calls)
+*/
+func (c *Client) Batch(ctx context.Context, calls []BatchCall) error {
+	batch := make(spec.BatchRequest, len(calls))
+	for i, call := range calls {
+		batch[i].Method = call.Method
+		batch[i].Params = call.Params
+	}
+	responses, err := c.Conn.RequestBatch(ctx, batch)
+	if err != nil {
+		return err
+	}
+	for i, resp := range responses {
+		if resp.Error != nil {
+			calls[i].Error = newError(resp.Error)
+			continue
+		}
+		calls[i].Error = c.decode(resp.Result, calls[i].Result)
+	}
+	return nil
+}
+
+// Sends notification to the server. Server does not reply to it.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	notification := spec.NewNotification()
+	notification.Method = method
+	notification.Params = params
+	return c.send(notification)
+}
+
+// Subscribes to server subscription or topic, i.e. "example.subscribe.time"
+// or "eth_subscribe" with params ["newHeads"]. Messages are received from
+// Subscription.C until it is closed.
+func (c *Client) Subscribe(ctx context.Context, method string, params interface{}) (*Subscription, error) {
+	unsubscribe, named, ok := unsubscribeMethod(method)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a subscription method", method)
+	}
+	request := spec.NewRequest()
+	request.Method = method
+	request.Params = params
+	request.ID = fmt.Sprintf("sub-%d", atomic.AddUint64(&c.lastSubID, 1))
+	sub := newSubscription(c, request.ID, unsubscribe)
+	if !named {
+		sub.unsubscribeParams = nameParam(params)
+	}
+	c.subscriptions.Put(sub.key, sub)
+	if err := c.send(request); err != nil {
+		c.subscriptions.Delete(sub.key)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Closes connection to the server and waits until it is closed
+func (c *Client) Close() error {
+	c.Conn.Close()
+	<-c.Conn.Done()
+	return nil
+}
+
+// Done is closed when connection to the server is closed
+func (c *Client) Done() <-chan interface{} {
+	return c.Conn.Done()
+}
+
+// Reads incoming messages until connection is closed. Responses are passed
+// to waiting calls or subscriptions, requests are served by the registry.
+func (c *Client) goHandle() {
+	defer func() {
+		err := c.Conn.Err()
+		if err == nil {
+			err = conn.ErrClosed
+		}
+		subs := []*Subscription{}
+		c.subscriptions.Each(func(sub *Subscription) {
+			subs = append(subs, sub)
+		})
+		for _, sub := range subs {
+			sub.close(err)
+		}
+	}()
+	for msg := range c.Conn.In {
+		data, tp := spec.ParseCodec(c.Codec, msg)
+		switch tp {
+		case spec.TypeResponse:
+			c.resolve(data.(spec.Response))
+		case spec.TypeBatchResponse:
+			for _, resp := range data.(spec.BatchResponse) {
+				c.resolve(resp)
+			}
+		case spec.TypeRequest:
+			go func(request spec.Request) {
+				c.send(c.call(request))
+			}(data.(spec.Request))
+		case spec.TypeBatchRequest:
+			go c.callBatch(data.(spec.BatchRequest))
+		case spec.TypeNotification:
+			go func(notification spec.Notification) {
+				c.call(spec.Request{
+					Jsonrpc: notification.Jsonrpc,
+					Method:  notification.Method,
+					Params:  notification.Params,
+				})
+			}(data.(spec.Notification))
+		default:
+			c.logf("client: unexpected message: %s\n", msg)
+		}
+	}
+}
+
+// Passes response to subscription or call waiting for it
+func (c *Client) resolve(resp spec.Response) {
+	if sub, ok := c.subscriptions.GetOk(fmt.Sprint(resp.ID)); ok {
+		sub.deliver(resp)
+		return
+	}
+	if !c.Conn.Resolve(resp) {
+		c.logf("client: unexpected response Id:%v\n", resp.ID)
+	}
+}
+
+// Executes request sent by the server using registry
+func (c *Client) call(request spec.Request) spec.Response {
+	if c.Registry == nil {
+		return spec.NewResponseError(request.ID, *spec.NewError(spec.MethodNotFoundCode, "client does not serve methods"))
+	}
+	return c.Registry.Call(c.Conn.Context(), request, c.Conn)
+}
+
+// Executes batch request sent by the server and sends responses as one array
+func (c *Client) callBatch(batch spec.BatchRequest) {
+	result := spec.BatchResponse{}
+	for _, request := range batch {
+		resp := c.call(request)
+		if !request.IsNotification() {
+			result = append(result, resp)
+		}
+	}
+	if len(result) > 0 {
+		c.send(result)
+	}
+}
+
+// Encodes message using client codec and sends it to the server
+func (c *Client) send(msg interface{}) error {
+	data, err := c.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.Conn.Send(data)
+}
+
+// Decodes result received as generic json value into v
+func (c *Client) decode(result interface{}, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	data, err := c.Codec.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(data, v)
+}
+
+// Prints log when logs are turned on
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.LogsOn {
+		c.Logger.Printf(format, v...)
+	}
+}
+
+// Returns unsubscribe method for subscribe method, i.e.
+// "example.subscribe.time" => "example.unsubscribe.time" or
+// "eth_subscribe" => "eth_unsubscribe". Named is false when subscription
+// name is not part of method.
+func unsubscribeMethod(method string) (unsubscribe string, named bool, ok bool) {
+	for _, sep := range []string{".", "/", "_"} {
+		parts := strings.Split(method, sep)
+		for i := 1; i < len(parts); i++ {
+			if parts[0] != "" && strings.EqualFold(parts[i], "subscribe") {
+				parts[i] = "unsubscribe"
+				return strings.Join(parts, sep), i < len(parts)-1, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// Returns params with the first param when it is a string, i.e. the
+// subscription name of "eth_subscribe" params ["newHeads"]. Returns nil
+// otherwise.
+func nameParam(params interface{}) interface{} {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Len() == 0 {
+		return nil
+	}
+	first := v.Index(0)
+	if first.Kind() == reflect.Interface {
+		first = first.Elem()
+	}
+	if first.Kind() != reflect.String {
+		return nil
+	}
+	return []interface{}{first.String()}
+}
@@ -0,0 +1,127 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/jrpctest"
+	"github.com/kroksys/jrpc/registry"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Server service notifying the client that called it
+type Notifier struct{}
+
+func (Notifier) Show(ctx context.Context, text string) (bool, error) {
+	c, ok := registry.ConnFromContext(ctx)
+	if !ok {
+		return false, errors.New("missing connection")
+	}
+	notification := spec.NewNotification()
+	notification.Method = "ui.Show"
+	notification.Params = []interface{}{text}
+	data, err := spec.DefaultCodec.Marshal(notification)
+	if err != nil {
+		return false, err
+	}
+	return true, c.Send(data)
+}
+
+// Client service receiving notifications from the server
+type UI struct {
+	shown chan string
+}
+
+func (u UI) Show(text string) {
+	u.shown <- text
+}
+
+func (u UI) Confirm(question string) (bool, error) {
+	if question == "" {
+		return false, errors.New("empty question")
+	}
+	return true, nil
+}
+
+// Server service asking the client that called it with conn.Request
+type Asker struct{}
+
+func (Asker) Ask(ctx context.Context, question string) (bool, error) {
+	c, ok := registry.ConnFromContext(ctx)
+	if !ok {
+		return false, errors.New("missing connection")
+	}
+	resp, err := c.Request(ctx, "ui.Confirm", []interface{}{question})
+	if err != nil {
+		return false, err
+	}
+	if resp.Error != nil {
+		return false, fmt.Errorf("client error %d: %v", resp.Error.Code, resp.Error.Data)
+	}
+	return resp.Result == true, nil
+}
+
+func TestServerNotifiesClientRegistry(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("notifier", Notifier{}); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := registry.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui := UI{shown: make(chan string, 1)}
+	if err := reg.Register("ui", ui); err != nil {
+		t.Fatal(err)
+	}
+	h := jrpctest.New(t, s, client.WithRegistry(reg))
+
+	h.Call(t, "notifier.Show", []interface{}{"hello"}).Expect(true)
+	select {
+	case text := <-ui.shown:
+		if text != "hello" {
+			t.Fatalf("shown %q, expected %q", text, "hello")
+		}
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("notification was not delivered to client registry")
+	}
+}
+
+func TestClientRegistryAnswersServerRequests(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("asker", Asker{}); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := registry.NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("ui", UI{}); err != nil {
+		t.Fatal(err)
+	}
+	h := jrpctest.New(t, s, client.WithRegistry(reg))
+
+	h.Call(t, "asker.Ask", []interface{}{"sure?"}).Expect(true)
+	// Error returned by client method is sent back to the server
+	h.Call(t, "asker.Ask", []interface{}{""}).ExpectErrorData("client error -32603: empty question")
+
+	// Client without registry answers that it does not serve methods
+	c := h.NewClient(t)
+	var ok bool
+	err = c.Call(context.Background(), "asker.Ask", []interface{}{"sure?"}, &ok)
+	var callErr *client.Error
+	if !errors.As(err, &callErr) || callErr.Data != "client error -32601: client does not serve methods" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
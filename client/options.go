@@ -0,0 +1,85 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kroksys/jrpc/registry"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Option configures Client created with Dial
+type Option func(*Client) error
+
+// Turns on/off logs for client
+func WithLogs(logsOn bool) Option {
+	return func(c *Client) error {
+		c.LogsOn = logsOn
+		return nil
+	}
+}
+
+// Sets logger used when logs are turned on. Default is log.Default().
+func WithLogger(logger registry.Logger) Option {
+	return func(c *Client) error {
+		if logger == nil {
+			return errors.New("logger can not be nil")
+		}
+		c.Logger = logger
+		return nil
+	}
+}
+
+// Sets codec used to decode incoming and encode outgoing messages
+func WithCodec(codec spec.Codec) Option {
+	return func(c *Client) error {
+		if codec == nil {
+			return errors.New("codec can not be nil")
+		}
+		c.Codec = codec
+		return nil
+	}
+}
+
+// Sets registry serving requests and notifications sent by the server.
+// Services are registered the same way as on the server.
+/*
+	reg, _ := registry.NewRegistry()
+	reg.Register("ui", UI{})
+	c, err := client.Dial(ctx, url, client.WithRegistry(reg))
+*/
+func WithRegistry(reg *registry.Registry) Option {
+	return func(c *Client) error {
+		c.Registry = reg
+		return nil
+	}
+}
+
+// Sets headers sent with upgrade request (i.e. Authorization)
+func WithHeader(header http.Header) Option {
+	return func(c *Client) error {
+		c.Header = header
+		return nil
+	}
+}
+
+// Sets subprotocols requested during upgrade in preferred order
+func WithSubprotocols(protocols ...string) Option {
+	return func(c *Client) error {
+		c.Subprotocols = append(c.Subprotocols, protocols...)
+		return nil
+	}
+}
+
+// Sets time to wait for response to a call when its context has no
+// deadline. Zero means no timeout.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		if d < 0 {
+			return errors.New("request timeout can not be negative")
+		}
+		c.ConnConfig.RequestTimeout = d
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Number of received messages waiting to be read from Subscription.C
+const subscriptionBuffer = 64
+
+var (
+	ErrUnsubscribed = errors.New("unsubscribed")
+	ErrOverflow     = errors.New("subscription closed: messages are not read fast enough")
+)
+
+// Subscription receives messages the server sends for a subscribe request.
+// Topic subscriptions first receive "subscribed" confirmation. Subscription
+// ends when the server returns an error or empty result, on Unsubscribe,
+// when C is full (ErrOverflow) or when connection is closed.
+type Subscription struct {
+	// Request ID used by the server for subscription messages
+	ID interface{}
+
+	// Received message results. Closed when subscription ends.
+	C chan interface{}
+
+	client            *Client
+	key               string
+	unsubscribe       string
+	unsubscribeParams interface{}
+	err               error
+	done              chan struct{}
+	closeOnce         sync.Once
+	lock              sync.Mutex
+}
+
+// Creates subscription for request ID
+func newSubscription(c *Client, id interface{}, unsubscribe string) *Subscription {
+	return &Subscription{
+		ID:          id,
+		C:           make(chan interface{}, subscriptionBuffer),
+		client:      c,
+		key:         fmt.Sprint(id),
+		unsubscribe: unsubscribe,
+		done:        make(chan struct{}),
+	}
+}
+
+// Decodes message received from C into v
+func (s *Subscription) Decode(msg interface{}, v interface{}) error {
+	return s.client.decode(msg, v)
+}
+
+// Closes the subscription and asks the server to stop it. Messages
+// received after Unsubscribe is called are dropped.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	s.close(ErrUnsubscribed)
+	return s.client.Call(ctx, s.unsubscribe, s.unsubscribeParams, nil)
+}
+
+// Returns why subscription ended: error returned by the server,
+// ErrUnsubscribed or connection error. Nil while running or when the
+// server ended it without error.
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Done is closed when subscription ends
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Waits for "subscribed" confirmation sent for topic subscriptions. Returns
+// error when subscription ends instead.
+func (s *Subscription) WaitSubscribed(ctx context.Context) error {
+	select {
+	case _, ok := <-s.C:
+		if !ok {
+			if err := s.Err(); err != nil {
+				return err
+			}
+			return ErrUnsubscribed
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns chanel of subscription messages decoded into T. Messages that
+// can not be decoded are skipped. Chanel is closed when subscription ends
+// and all received messages are read, so it should be read until closed.
+/*
+	sub, err := c.Subscribe(ctx, "example.subscribe.time", nil)
+	for t := range client.Messages[time.Time](sub) {
+		fmt.Println(t)
+	}
+*/
+func Messages[T any](s *Subscription) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for msg := range s.C {
+			var v T
+			if err := s.Decode(msg, &v); err != nil {
+				s.client.logf("client: subscription %v decode error: %s\n", s.ID, err)
+				continue
+			}
+			out <- v
+		}
+	}()
+	return out
+}
+
+// Passes received message to C. Never blocks reading from the connection:
+// when C is full the subscription is closed with ErrOverflow and the server
+// is asked to stop it.
+func (s *Subscription) deliver(resp spec.Response) {
+	switch {
+	case resp.Error != nil:
+		s.close(newError(resp.Error))
+	case resp.Result == nil:
+		s.close(nil)
+	case !s.send(resp.Result):
+		s.client.logf("client: subscription %v overflow, unsubscribing\n", s.ID)
+		s.close(ErrOverflow)
+		go s.client.Call(s.client.Conn.Context(), s.unsubscribe, s.unsubscribeParams, nil)
+	}
+}
+
+// Passes message to C unless subscription is closed. Returns false when C
+// is full.
+func (s *Subscription) send(msg interface{}) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.done:
+		return true
+	default:
+	}
+	select {
+	case s.C <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Removes subscription from client and closes C once
+func (s *Subscription) close(err error) {
+	s.closeOnce.Do(func() {
+		s.client.subscriptions.Delete(s.key)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.err = err
+		close(s.done)
+		close(s.C)
+	})
+}
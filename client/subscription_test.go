@@ -0,0 +1,82 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/jrpctest"
+	"github.com/kroksys/jrpc/registry"
+)
+
+type Feed struct{}
+
+// Sends count messages and waits until unsubscribed
+func (Feed) Flood(sub *registry.Subscription, count int) error {
+	for i := 0; i < count; i++ {
+		if err := sub.Notify(i); err != nil {
+			return err
+		}
+	}
+	select {
+	case <-sub.Exit:
+	case <-sub.Conn.Exit:
+	}
+	return nil
+}
+
+func (Feed) Ping() string {
+	return "pong"
+}
+
+// Starts harness with Feed service registered as "feed"
+func newFeedHarness(t *testing.T) *jrpctest.Harness {
+	t.Helper()
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("feed", Feed{}); err != nil {
+		t.Fatal(err)
+	}
+	return jrpctest.New(t, s)
+}
+
+func TestSubscriptionOverflowDoesNotBlockConnection(t *testing.T) {
+	h := newFeedHarness(t)
+	sub, err := h.Client.Subscribe(context.Background(), "feed.subscribe.Flood", []interface{}{1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sub.Done():
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("subscription was not closed when its chanel was full")
+	}
+	if !errors.Is(sub.Err(), client.ErrOverflow) {
+		t.Fatalf("expected ErrOverflow, got %v", sub.Err())
+	}
+	h.Call(t, "feed.Ping", nil).Expect("pong")
+}
+
+func TestUnsubscribeDropsLaterMessages(t *testing.T) {
+	h := newFeedHarness(t)
+	sub := h.Subscribe(t, "feed.subscribe.Flood", []interface{}{10})
+	sub.Expect(0)
+	sub.Unsubscribe()
+
+	received := 0
+	for range sub.Sub.C {
+		received++
+	}
+	if received > 9 {
+		t.Fatalf("received %d messages after unsubscribe", received)
+	}
+	if !errors.Is(sub.Sub.Err(), client.ErrUnsubscribed) {
+		t.Fatalf("expected ErrUnsubscribed, got %v", sub.Sub.Err())
+	}
+	h.Call(t, "feed.Ping", nil).Expect("pong")
+}
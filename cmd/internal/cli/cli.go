@@ -0,0 +1,41 @@
+// Package cli holds helpers shared by jrpc commands.
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Flag collecting repeated headers "Key: Value"
+/*
+	header := cli.HeaderFlag{}
+	flag.Var(header, "H", "header sent with upgrade request \"Key: Value\", can be repeated")
+*/
+type HeaderFlag http.Header
+
+func (h HeaderFlag) String() string {
+	return ""
+}
+
+func (h HeaderFlag) Set(v string) error {
+	key, value, ok := strings.Cut(v, ":")
+	if !ok {
+		return fmt.Errorf("header must be \"Key: Value\", got %q", v)
+	}
+	http.Header(h).Add(strings.TrimSpace(key), strings.TrimSpace(value))
+	return nil
+}
+
+// Converts http(s) url to ws(s), adds ws:// when scheme is missing
+func WebsocketURL(url string) string {
+	switch {
+	case strings.HasPrefix(url, "http://"):
+		return "ws://" + strings.TrimPrefix(url, "http://")
+	case strings.HasPrefix(url, "https://"):
+		return "wss://" + strings.TrimPrefix(url, "https://")
+	case !strings.Contains(url, "://"):
+		return "ws://" + url
+	}
+	return url
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWebsocketURL(t *testing.T) {
+	tests := map[string]string{
+		"http://localhost:3333/ws":  "ws://localhost:3333/ws",
+		"https://example.com/ws":    "wss://example.com/ws",
+		"localhost:3333/ws":         "ws://localhost:3333/ws",
+		"ws://localhost:3333/ws":    "ws://localhost:3333/ws",
+		"wss://example.com:443/rpc": "wss://example.com:443/rpc",
+	}
+	for url, expected := range tests {
+		if got := WebsocketURL(url); got != expected {
+			t.Fatalf("%s: got %s, expected %s", url, got, expected)
+		}
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	h := HeaderFlag{}
+	for _, v := range []string{"Authorization: Bearer abc", "X-Tag:a", "x-tag: b"} {
+		if err := h.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := http.Header{"Authorization": {"Bearer abc"}, "X-Tag": {"a", "b"}}
+	if !reflect.DeepEqual(http.Header(h), expected) {
+		t.Fatalf("got %v, expected %v", http.Header(h), expected)
+	}
+	if err := h.Set("no colon"); err == nil {
+		t.Fatal("expected error for header without colon")
+	}
+}
@@ -0,0 +1,389 @@
+// Command jrpc-bench measures how many calls and subscriptions a jrpc
+// server sustains. It opens connections, runs a weighted mix of calls,
+// batches and subscriptions on each of them and reports throughput, latency
+// percentiles, errors by code and subscription message rates.
+//
+//	jrpc-bench -url ws://localhost:3333/ws -conns 50 -duration 30s
+//	jrpc-bench -mix call=6,batch=2,subscribe=2 -batch 20 -sub-hold 2s
+//	jrpc-bench -method example.SimpleObject -params '{"X":1,"Y":2}' -rate 100
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/cmd/internal/cli"
+)
+
+// Benchmark settings
+type config struct {
+	url         string
+	header      http.Header
+	protocol    string
+	conns       int
+	workers     int
+	duration    time.Duration
+	timeout     time.Duration
+	rate        float64
+	mix         map[string]int
+	method      string
+	params      interface{}
+	batchSize   int
+	subMethod   string
+	subParams   interface{}
+	subHold     time.Duration
+	jsonOutput  bool
+	dialTimeout time.Duration
+}
+
+func main() {
+	header := cli.HeaderFlag{}
+	flag.Var(header, "H", "header sent with upgrade request \"Key: Value\", can be repeated")
+	url := flag.String("url", "ws://localhost:3333/ws", "websocket url of the server")
+	protocol := flag.String("protocol", "", "subprotocol requested during upgrade")
+	conns := flag.Int("conns", 10, "number of connections")
+	workers := flag.Int("workers", 1, "concurrent workers per connection")
+	duration := flag.Duration("duration", time.Second*10, "duration of the run")
+	timeout := flag.Duration("timeout", time.Second*10, "time to wait for a response")
+	rate := flag.Float64("rate", 0, "operations per second of every worker, 0 is unlimited")
+	mix := flag.String("mix", "call=1", "weighted mix of operations: call, batch and subscribe")
+	method := flag.String("method", "example.Simple", "method used by calls and batches")
+	params := flag.String("params", "[1,2]", "json params of calls and batches")
+	batchSize := flag.Int("batch", 10, "number of calls in a batch")
+	subMethod := flag.String("sub-method", "example.subscribe.Subscription", "subscription method")
+	subParams := flag.String("sub-params", "", "json params of subscriptions")
+	subHold := flag.Duration("sub-hold", time.Second, "how long a subscription is kept before unsubscribing")
+	jsonOutput := flag.Bool("json", false, "print report as json")
+	flag.Parse()
+
+	cfg := config{
+		url:         cli.WebsocketURL(*url),
+		header:      http.Header(header),
+		protocol:    *protocol,
+		conns:       *conns,
+		workers:     *workers,
+		duration:    *duration,
+		timeout:     *timeout,
+		rate:        *rate,
+		method:      *method,
+		batchSize:   *batchSize,
+		subMethod:   *subMethod,
+		subHold:     *subHold,
+		jsonOutput:  *jsonOutput,
+		dialTimeout: *timeout,
+	}
+	var err error
+	if cfg.mix, err = parseMix(*mix); err != nil {
+		fail(err)
+	}
+	if cfg.params, err = parseJSON(*params); err != nil {
+		fail(fmt.Errorf("params: %w", err))
+	}
+	if cfg.subParams, err = parseJSON(*subParams); err != nil {
+		fail(fmt.Errorf("sub-params: %w", err))
+	}
+	if cfg.conns < 1 || cfg.workers < 1 || cfg.batchSize < 1 {
+		fail(errors.New("conns, workers and batch must be positive"))
+	}
+
+	r := run(cfg)
+	if cfg.jsonOutput {
+		if err := r.printJSON(os.Stdout); err != nil {
+			fail(err)
+		}
+		return
+	}
+	r.print(os.Stdout)
+}
+
+// Connects, runs workers until duration passes or Ctrl-C is pressed and
+// returns merged results
+func run(cfg config) report {
+	clients := dial(cfg)
+	if len(clients) == 0 {
+		fail(errors.New("no connection to the server"))
+	}
+	connectErrs := cfg.conns - len(clients)
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	results := make(chan *stats)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for i, c := range clients {
+		for j := 0; j < cfg.workers; j++ {
+			wg.Add(1)
+			w := &worker{
+				cfg:    cfg,
+				client: c,
+				rand:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(i*cfg.workers+j))),
+				stats:  newStats(),
+			}
+			go func() {
+				defer wg.Done()
+				w.run(ctx)
+				results <- w.stats
+			}()
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	total := newStats()
+	for s := range results {
+		total.merge(s)
+	}
+	return newReport(total, cfg.conns, connectErrs, time.Since(start))
+}
+
+// Opens connections concurrently. Failed connections are reported.
+func dial(cfg config) []*client.Client {
+	opts := []client.Option{
+		client.WithHeader(cfg.header),
+		client.WithRequestTimeout(cfg.timeout),
+	}
+	if cfg.protocol != "" {
+		opts = append(opts, client.WithSubprotocols(cfg.protocol))
+	}
+	clients := []*client.Client{}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < cfg.conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.dialTimeout)
+			defer cancel()
+			c, err := client.Dial(ctx, cfg.url, opts...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "connect: %s\n", err)
+				return
+			}
+			lock.Lock()
+			clients = append(clients, c)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	return clients
+}
+
+// Runs operations on a connection
+type worker struct {
+	cfg    config
+	client *client.Client
+	rand   *rand.Rand
+	stats  *stats
+}
+
+// Runs operations picked by mix weights until ctx is done
+func (w *worker) run(ctx context.Context) {
+	var tick <-chan time.Time
+	if w.cfg.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / w.cfg.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.client.Done():
+			w.stats.fail(w.client.Conn.Err())
+			return
+		default:
+		}
+		switch w.pick() {
+		case opCall:
+			w.call()
+		case opBatch:
+			w.batch()
+		case opSubscribe:
+			w.subscribe(ctx)
+		}
+	}
+}
+
+// Picks operation by mix weights
+func (w *worker) pick() string {
+	total := 0
+	for _, weight := range w.cfg.mix {
+		total += weight
+	}
+	n := w.rand.Intn(total)
+	for _, op := range []string{opCall, opBatch, opSubscribe} {
+		if n < w.cfg.mix[op] {
+			return op
+		}
+		n -= w.cfg.mix[op]
+	}
+	return opCall
+}
+
+// Runs a single call. Error responses are measured as well.
+func (w *worker) call() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.timeout)
+	defer cancel()
+	start := time.Now()
+	err := w.client.Call(ctx, w.cfg.method, w.cfg.params, nil)
+	if err != nil {
+		w.stats.fail(err)
+	}
+	if err == nil || isResponse(err) {
+		w.stats.observe(opCall, time.Since(start))
+	}
+}
+
+// Runs a batch of calls. Latency is the time until all responses arrive.
+func (w *worker) batch() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.timeout)
+	defer cancel()
+	calls := make([]client.BatchCall, w.cfg.batchSize)
+	for i := range calls {
+		calls[i] = client.BatchCall{Method: w.cfg.method, Params: w.cfg.params}
+	}
+	start := time.Now()
+	if err := w.client.Batch(ctx, calls); err != nil {
+		w.stats.fail(err)
+		return
+	}
+	w.stats.observe(opBatch, time.Since(start))
+	for _, call := range calls {
+		if call.Error != nil {
+			w.stats.fail(call.Error)
+			continue
+		}
+		w.stats.batchCalls++
+	}
+}
+
+// Subscribes, counts messages for sub-hold and unsubscribes. Latency is
+// the time until the first message.
+func (w *worker) subscribe(ctx context.Context) {
+	start := time.Now()
+	sub, err := w.client.Subscribe(ctx, w.cfg.subMethod, w.cfg.subParams)
+	if err != nil {
+		w.stats.fail(err)
+		return
+	}
+	hold := time.NewTimer(w.cfg.subHold)
+	defer hold.Stop()
+	messages := 0
+	ended := false
+	for !ended {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				ended = true
+				continue
+			}
+			if messages == 0 {
+				w.stats.latencies[opSubscribe] = append(w.stats.latencies[opSubscribe], time.Since(start))
+			}
+			messages++
+		case <-hold.C:
+			ended = true
+		case <-ctx.Done():
+			ended = true
+		}
+	}
+	w.stats.ops[opSubscribe]++
+	w.stats.messages += messages
+	w.stats.subscribedFor += time.Since(start)
+
+	if err := sub.Err(); err != nil {
+		w.stats.fail(err)
+		return
+	}
+	unsubscribeCtx, cancel := context.WithTimeout(context.Background(), w.cfg.timeout)
+	defer cancel()
+	select {
+	case <-sub.Done():
+		// Ended by the server
+	default:
+		if err := sub.Unsubscribe(unsubscribeCtx); err != nil {
+			w.stats.fail(err)
+		}
+	}
+}
+
+// Checks if error was returned by the server in a response
+func isResponse(err error) bool {
+	var rpcErr *client.Error
+	return errors.As(err, &rpcErr)
+}
+
+// Parses mix of operations, i.e. "call=8,batch=1,subscribe=1"
+func parseMix(s string) (map[string]int, error) {
+	mix := map[string]int{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		op, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			weight = "1"
+		}
+		if op != opCall && op != opBatch && op != opSubscribe {
+			return nil, fmt.Errorf("unknown operation %q in mix", op)
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight %q of %s", weight, op)
+		}
+		mix[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("mix has no operations")
+	}
+	return mix, nil
+}
+
+// Parses json value, empty string is nil
+func parseJSON(s string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var v interface{}
+	return v, json.Unmarshal([]byte(s), &v)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/conn"
+)
+
+// Kinds of measured operations
+const (
+	opCall      = "call"
+	opBatch     = "batch"
+	opSubscribe = "subscribe"
+)
+
+// Results collected by one worker. Workers keep their own stats which are
+// merged when the run ends, so measuring needs no locking.
+type stats struct {
+	// Latencies of operations by kind. Subscription latency is the time
+	// until the first message.
+	latencies map[string][]time.Duration
+
+	// Number of finished operations by kind and calls sent in batches
+	ops        map[string]int
+	batchCalls int
+
+	// Errors by JSON-RPC error code or by kind of client error
+	errors map[string]int
+
+	// Subscription messages received and time subscriptions were active
+	messages      int
+	subscribedFor time.Duration
+}
+
+// Creates empty stats
+func newStats() *stats {
+	return &stats{
+		latencies: map[string][]time.Duration{},
+		ops:       map[string]int{},
+		errors:    map[string]int{},
+	}
+}
+
+// Records finished operation
+func (s *stats) observe(op string, latency time.Duration) {
+	s.ops[op]++
+	s.latencies[op] = append(s.latencies[op], latency)
+}
+
+// Records error under its JSON-RPC code or client error kind
+func (s *stats) fail(err error) {
+	s.errors[errorKey(err)]++
+}
+
+// Adds stats of another worker
+func (s *stats) merge(o *stats) {
+	for op, l := range o.latencies {
+		s.latencies[op] = append(s.latencies[op], l...)
+	}
+	for op, n := range o.ops {
+		s.ops[op] += n
+	}
+	for key, n := range o.errors {
+		s.errors[key] += n
+	}
+	s.batchCalls += o.batchCalls
+	s.messages += o.messages
+	s.subscribedFor += o.subscribedFor
+}
+
+// Returns error key used in report. Server errors are counted by code and
+// message only, so data that differs per call (i.e. retryAfter of rate
+// limited calls) does not split them into separate keys.
+func errorKey(err error) string {
+	var rpcErr *client.Error
+	switch {
+	case errors.As(err, &rpcErr):
+		return fmt.Sprintf("%d %s", rpcErr.Code, rpcErr.Message)
+	case errors.Is(err, conn.ErrRequestTimeout):
+		return "timeout"
+	case errors.Is(err, conn.ErrClosed):
+		return "connection closed"
+	}
+	return "error: " + err.Error()
+}
+
+// Summary of a run
+type report struct {
+	Connections int           `json:"connections"`
+	ConnectErrs int           `json:"connectErrors"`
+	Duration    time.Duration `json:"duration"`
+
+	// Finished operations by kind and their rate per second
+	Ops        map[string]int     `json:"ops"`
+	Throughput map[string]float64 `json:"throughput"`
+
+	// Calls per second including calls sent in batches
+	CallRate float64 `json:"callRate"`
+
+	Latency map[string]percentiles `json:"latency"`
+	Errors  map[string]int         `json:"errors"`
+
+	// Subscription messages in total, per second and per second of a single
+	// subscription
+	Messages            int     `json:"messages"`
+	MessageRate         float64 `json:"messageRate"`
+	MessageRatePerSub   float64 `json:"messageRatePerSubscription"`
+	SubscriptionSeconds float64 `json:"subscriptionSeconds"`
+}
+
+// Latency distribution of an operation
+type percentiles struct {
+	Min time.Duration `json:"min"`
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Creates report from merged stats
+func newReport(s *stats, connections, connectErrs int, elapsed time.Duration) report {
+	r := report{
+		Connections: connections,
+		ConnectErrs: connectErrs,
+		Duration:    elapsed,
+		Ops:         s.ops,
+		Throughput:  map[string]float64{},
+		Latency:     map[string]percentiles{},
+		Errors:      s.errors,
+		Messages:    s.messages,
+	}
+	seconds := elapsed.Seconds()
+	for op, n := range s.ops {
+		r.Throughput[op] = float64(n) / seconds
+	}
+	r.CallRate = float64(s.ops[opCall]+s.batchCalls) / seconds
+	for op, l := range s.latencies {
+		r.Latency[op] = newPercentiles(l)
+	}
+	r.MessageRate = float64(s.messages) / seconds
+	r.SubscriptionSeconds = s.subscribedFor.Seconds()
+	if r.SubscriptionSeconds > 0 {
+		r.MessageRatePerSub = float64(s.messages) / r.SubscriptionSeconds
+	}
+	return r
+}
+
+// Calculates percentiles of latencies
+func newPercentiles(l []time.Duration) percentiles {
+	if len(l) == 0 {
+		return percentiles{}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	at := func(p float64) time.Duration {
+		return l[int(p*float64(len(l)-1))]
+	}
+	return percentiles{Min: l[0], P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: l[len(l)-1]}
+}
+
+// Prints report as text table
+func (r report) print(w io.Writer) {
+	fmt.Fprintf(w, "connections:  %d (%d failed)\n", r.Connections, r.ConnectErrs)
+	fmt.Fprintf(w, "duration:     %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "call rate:    %.1f/s (including calls in batches)\n\n", r.CallRate)
+	fmt.Fprintf(w, "%-10s %8s %10s %10s %10s %10s %10s %10s\n", "op", "count", "rate/s", "min", "p50", "p90", "p99", "max")
+	for _, op := range []string{opCall, opBatch, opSubscribe} {
+		if r.Ops[op] == 0 {
+			continue
+		}
+		p := r.Latency[op]
+		fmt.Fprintf(w, "%-10s %8d %10.1f %10s %10s %10s %10s %10s\n", op, r.Ops[op], r.Throughput[op],
+			round(p.Min), round(p.P50), round(p.P90), round(p.P99), round(p.Max))
+	}
+	if r.Ops[opSubscribe] > 0 {
+		fmt.Fprintf(w, "\nsubscription messages: %d, %.1f/s total, %.1f/s per subscription\n",
+			r.Messages, r.MessageRate, r.MessageRatePerSub)
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(w, "\nerrors:\n")
+		keys := make([]string, 0, len(r.Errors))
+		for key := range r.Errors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %8d  %s\n", r.Errors[key], strings.TrimSpace(key))
+		}
+	}
+}
+
+// Prints report as json
+func (r report) printJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Rounds latency for printing
+func round(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond * 10).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/spec"
+)
+
+func TestErrorKey(t *testing.T) {
+	limited := func(retryAfter float64) error {
+		return &client.Error{
+			Code:    spec.RateLimitedCode,
+			Message: "Rate limit exceeded",
+			Data:    spec.RateLimitedData{RetryAfter: retryAfter},
+		}
+	}
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{limited(0.5), fmt.Sprintf("%d Rate limit exceeded", spec.RateLimitedCode)},
+		{limited(1.25), fmt.Sprintf("%d Rate limit exceeded", spec.RateLimitedCode)},
+		{fmt.Errorf("call: %w", conn.ErrRequestTimeout), "timeout"},
+		{conn.ErrClosed, "connection closed"},
+		{errors.New("dial failed"), "error: dial failed"},
+	}
+	for _, test := range tests {
+		if got := errorKey(test.err); got != test.expected {
+			t.Fatalf("%v: got %q, expected %q", test.err, got, test.expected)
+		}
+	}
+}
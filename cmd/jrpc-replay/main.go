@@ -0,0 +1,83 @@
+// Command jrpc-replay sends messages of a recording made with
+// jrpc.WithRecorder to a server and prints differences between recorded
+// responses and responses of the server. Exits with status 1 when they
+// differ.
+//
+//	jrpc-replay -in traffic.jsonl -url ws://localhost:3333/ws
+//	jrpc-replay -in traffic.jsonl -conn 6f1c... -timing -ignore time,requestId
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kroksys/jrpc/recorder"
+)
+
+func main() {
+	in := flag.String("in", "", "recording file")
+	url := flag.String("url", "ws://localhost:3333/ws", "websocket url of the server")
+	connID := flag.String("conn", "", "replay only connection with this id")
+	timing := flag.Bool("timing", false, "keep recorded gaps between messages")
+	wait := flag.Duration("wait", recorder.DefaultReplayWait, "time to wait for responses after the last message")
+	ignore := flag.String("ignore", "", "comma separated object keys ignored when comparing messages")
+	flag.Parse()
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	entries, err := recorder.ReadFile(*in)
+	if err != nil {
+		fail(err)
+	}
+	if *connID != "" {
+		entries = filter(entries, *connID)
+	}
+	opts := []recorder.Option{recorder.WithWait(*wait)}
+	if *timing {
+		opts = append(opts, recorder.KeepTiming())
+	}
+	if *ignore != "" {
+		opts = append(opts, recorder.Ignore(strings.Split(*ignore, ",")...))
+	}
+
+	start := time.Now()
+	diffs, err := recorder.Replay(context.Background(), entries, recorder.WebsocketDialer(*url), opts...)
+	if err != nil {
+		fail(err)
+	}
+	sent := 0
+	for _, e := range entries {
+		if e.Dir == recorder.In {
+			sent++
+		}
+	}
+	if len(diffs) > 0 {
+		fmt.Println(recorder.Format(diffs))
+	}
+	fmt.Printf("replayed %d messages in %s, %d differences\n", sent, time.Since(start).Round(time.Millisecond), len(diffs))
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Returns entries of a single connection
+func filter(entries []recorder.Entry, connID string) []recorder.Entry {
+	result := []recorder.Entry{}
+	for _, e := range entries {
+		if e.Conn == connID {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
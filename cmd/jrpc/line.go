@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Returned by ReadLine when Ctrl-C is pressed on an empty line
+var errInterrupt = errors.New("interrupt")
+
+// Line editor with history and tab completion. Works in raw terminal mode,
+// otherwise reads whole lines.
+type lineEditor struct {
+	in     *bufio.Reader
+	out    io.Writer
+	prompt string
+	raw    bool
+
+	// Returns completion candidates for the word ending at pos
+	complete func(line []rune, pos int) []string
+
+	history []string
+	histPos int
+
+	// Line being edited and cursor position in it
+	buf     []rune
+	pos     int
+	editing bool
+	lock    sync.Mutex
+}
+
+// Creates line editor reading from in
+func newLineEditor(in io.Reader, out io.Writer, prompt string, raw bool) *lineEditor {
+	return &lineEditor{
+		in:     bufio.NewReader(in),
+		out:    out,
+		prompt: prompt,
+		raw:    raw,
+	}
+}
+
+// Loads history from file, one entry per line
+func (e *lineEditor) loadHistory(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+}
+
+// Saves last entries of history to file
+func (e *lineEditor) saveHistory(path string, max int) error {
+	history := e.history
+	if len(history) > max {
+		history = history[len(history)-max:]
+	}
+	return os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
+
+// Discards text printed after the editor is closed
+func (e *lineEditor) Close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.out = io.Discard
+	e.editing = false
+}
+
+// Prints text above the line being edited and redraws the line
+func (e *lineEditor) Printf(format string, v ...interface{}) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.editing {
+		fmt.Fprint(e.out, "\r\033[K")
+	}
+	fmt.Fprintf(e.out, format, v...)
+	if e.editing {
+		e.redraw()
+	}
+}
+
+// Reads a line. Returns io.EOF on Ctrl-D and errInterrupt on Ctrl-C when
+// the line is empty.
+func (e *lineEditor) ReadLine() (string, error) {
+	if !e.raw {
+		fmt.Fprint(e.out, e.prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	e.lock.Lock()
+	e.buf, e.pos, e.editing = nil, 0, true
+	e.histPos = len(e.history)
+	e.redraw()
+	e.lock.Unlock()
+	defer func() {
+		e.lock.Lock()
+		e.editing = false
+		e.lock.Unlock()
+	}()
+
+	saved := ""
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		e.lock.Lock()
+		switch r {
+		case '\r', '\n':
+			line := string(e.buf)
+			fmt.Fprint(e.out, "\n")
+			if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+				e.history = append(e.history, line)
+			}
+			e.lock.Unlock()
+			return line, nil
+		case 3: // Ctrl-C
+			empty := len(e.buf) == 0
+			fmt.Fprint(e.out, "^C\n")
+			e.buf, e.pos = nil, 0
+			if empty {
+				e.lock.Unlock()
+				return "", errInterrupt
+			}
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\n")
+				e.lock.Unlock()
+				return "", io.EOF
+			}
+			e.delete()
+		case 127, 8: // Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case 1: // Ctrl-A
+			e.pos = 0
+		case 5: // Ctrl-E
+			e.pos = len(e.buf)
+		case 21: // Ctrl-U
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case '\t':
+			e.completeWord()
+		case 27: // Escape sequence
+			e.lock.Unlock()
+			seq := e.readEscape()
+			e.lock.Lock()
+			switch seq {
+			case "[A": // Up
+				if e.histPos > 0 {
+					if e.histPos == len(e.history) {
+						saved = string(e.buf)
+					}
+					e.histPos--
+					e.setLine(e.history[e.histPos])
+				}
+			case "[B": // Down
+				if e.histPos < len(e.history) {
+					e.histPos++
+					if e.histPos == len(e.history) {
+						e.setLine(saved)
+					} else {
+						e.setLine(e.history[e.histPos])
+					}
+				}
+			case "[C": // Right
+				if e.pos < len(e.buf) {
+					e.pos++
+				}
+			case "[D": // Left
+				if e.pos > 0 {
+					e.pos--
+				}
+			case "[H", "OH", "[1~":
+				e.pos = 0
+			case "[F", "OF", "[4~":
+				e.pos = len(e.buf)
+			case "[3~": // Delete
+				e.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+				e.pos++
+			}
+		}
+		e.redraw()
+		e.lock.Unlock()
+	}
+}
+
+// Reads rest of escape sequence after ESC
+func (e *lineEditor) readEscape() string {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return ""
+	}
+	seq := []byte{b}
+	for {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			return string(seq)
+		}
+	}
+}
+
+// Deletes character under cursor
+func (e *lineEditor) delete() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// Replaces edited line
+func (e *lineEditor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+// Completes word before cursor. Single candidate is inserted, multiple
+// candidates are completed to their common prefix or listed.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start := e.pos
+	for start > 0 && e.buf[start-1] != ' ' {
+		start--
+	}
+	word := string(e.buf[start:e.pos])
+	candidates := e.complete(e.buf, e.pos)
+	if len(candidates) == 0 {
+		return
+	}
+	insert := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		insert += " "
+	}
+	if len(insert) > len(word) {
+		rest := append([]rune(insert[len(word):]), e.buf[e.pos:]...)
+		e.buf = append(e.buf[:e.pos], rest...)
+		e.pos += len([]rune(insert)) - len([]rune(word))
+		return
+	}
+	sort.Strings(candidates)
+	fmt.Fprint(e.out, "\r\033[K"+strings.Join(candidates, "  ")+"\n")
+}
+
+// Writes prompt and line and moves cursor to its position
+func (e *lineEditor) redraw() {
+	fmt.Fprint(e.out, "\r\033[K"+e.prompt+string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\033[%dD", back)
+	}
+}
+
+// Returns longest common prefix of strings
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
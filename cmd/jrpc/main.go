@@ -0,0 +1,226 @@
+// Command jrpc is a command-line client for jrpc servers. It runs single
+// calls, notifications and subscriptions or an interactive REPL with
+// history and tab completion of methods discovered with "rpc.Discover".
+//
+//	jrpc ws://localhost:3333/ws                                   REPL
+//	jrpc ws://localhost:3333/ws call example.Simple 1 2
+//	jrpc ws://localhost:3333/ws call example.SimpleObject X=1 Y=2
+//	jrpc ws://localhost:3333/ws call example.SimpleObject '{"X":1,"Y":2}'
+//	jrpc ws://localhost:3333/ws notify example.subscribe.Subscription
+//	jrpc ws://localhost:3333/ws subscribe example.subscribe.time
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/cmd/internal/cli"
+)
+
+func main() {
+	header := cli.HeaderFlag{}
+	flag.Var(header, "H", "header sent with upgrade request \"Key: Value\", can be repeated")
+	timeout := flag.Duration("timeout", time.Second*10, "time to wait for a response")
+	protocol := flag.String("protocol", "", "subprotocol requested during upgrade, i.e. jsonrpc-2.0")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	opts := []client.Option{
+		client.WithHeader(http.Header(header)),
+		client.WithRequestTimeout(*timeout),
+	}
+	if *protocol != "" {
+		opts = append(opts, client.WithSubprotocols(*protocol))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	c, err := client.Dial(ctx, cli.WebsocketURL(args[0]), opts...)
+	cancel()
+	if err != nil {
+		fail(err)
+	}
+	defer c.Close()
+
+	if len(args) == 1 {
+		if err := repl(c); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if len(args) < 3 {
+		usage()
+		os.Exit(2)
+	}
+	params, err := parseParams(args[3:])
+	if err != nil {
+		fail(err)
+	}
+	switch args[1] {
+	case "call":
+		err = call(c, args[2], params, os.Stdout)
+	case "notify":
+		err = notify(c, args[2], params)
+	case "subscribe":
+		err = subscribe(c, args[2], params)
+	default:
+		err = fmt.Errorf("unknown command %s", args[1])
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  jrpc [flags] URL                              interactive REPL
+  jrpc [flags] URL call METHOD [PARAMS...]      call method and print result
+  jrpc [flags] URL notify METHOD [PARAMS...]    send notification
+  jrpc [flags] URL subscribe METHOD [PARAMS...] print messages until Ctrl-C
+
+URL is ws://, wss://, http:// or https:// endpoint.
+PARAMS is a json array or object, key=value pairs sent as object or
+values sent as array. Values that are not valid json are sent as strings.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// Calls method and prints its result
+func call(c *client.Client, method string, params interface{}, w io.Writer) error {
+	var result interface{}
+	if err := c.Call(context.Background(), method, params, &result); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, formatJSON(result))
+	return nil
+}
+
+// Sends notification and waits until it is written. Closing the client
+// writes queued messages before close frame, so the command does not exit
+// before notification is sent.
+func notify(c *client.Client, method string, params interface{}) error {
+	if err := c.Notify(context.Background(), method, params); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// Prints subscription messages until it ends or Ctrl-C is pressed
+func subscribe(c *client.Client, method string, params interface{}) error {
+	sub, err := c.Subscribe(context.Background(), method, params)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	for {
+		select {
+		case msg, ok := <-sub.C:
+			if !ok {
+				return sub.Err()
+			}
+			fmt.Println(formatJSON(msg))
+		case <-interrupt:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			return sub.Unsubscribe(ctx)
+		}
+	}
+}
+
+// Parses command-line params. Single json array or object is sent as it is,
+// key=value pairs are sent as object and other values as array.
+func parseParams(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args) == 1 {
+		trimmed := strings.TrimSpace(args[0])
+		if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+			var params interface{}
+			if err := json.Unmarshal([]byte(trimmed), &params); err != nil {
+				return nil, fmt.Errorf("invalid json params: %w", err)
+			}
+			return params, nil
+		}
+	}
+	named := 0
+	for _, arg := range args {
+		if strings.Contains(arg, "=") && !strings.HasPrefix(arg, "=") {
+			named++
+		}
+	}
+	switch named {
+	case 0:
+		params := []interface{}{}
+		for _, arg := range args {
+			params = append(params, parseValue(arg))
+		}
+		return params, nil
+	case len(args):
+		params := map[string]interface{}{}
+		for _, arg := range args {
+			key, value, _ := strings.Cut(arg, "=")
+			params[key] = parseValue(value)
+		}
+		return params, nil
+	}
+	return nil, errors.New("params can not mix key=value pairs and values")
+}
+
+// Parses json value or returns the string itself
+func parseValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// Formats value as indented json
+func formatJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return out.String()
+}
+
+// Formats error. Errors returned by the server show code, message and data.
+func formatError(err error) string {
+	var rpcErr *client.Error
+	if !errors.As(err, &rpcErr) {
+		return "error: " + err.Error()
+	}
+	s := fmt.Sprintf("error %d: %s", rpcErr.Code, rpcErr.Message)
+	if rpcErr.Data != nil {
+		s += "\n  data: " + strings.ReplaceAll(formatJSON(rpcErr.Data), "\n", "\n  ")
+	}
+	return s
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, formatError(err))
+	os.Exit(1)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/jrpctest"
+)
+
+type Inbox struct {
+	received chan string
+}
+
+func (i Inbox) Put(text string) {
+	i.received <- text
+}
+
+func TestNotifyIsSentBeforeExit(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := Inbox{received: make(chan string, 1)}
+	if err := s.Register("inbox", inbox); err != nil {
+		t.Fatal(err)
+	}
+	h := jrpctest.New(t, s)
+	c := h.NewClient(t)
+
+	if err := notify(c, "inbox.Put", []interface{}{"hello"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("notify returned before connection was closed")
+	}
+	select {
+	case text := <-inbox.received:
+		if text != "hello" {
+			t.Fatalf("received %q, expected %q", text, "hello")
+		}
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("notification was not received")
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "null"},
+		{[]string{"1", "2"}, "[\n  1,\n  2\n]"},
+		{[]string{"X=1", "Y=a"}, "{\n  \"X\": 1,\n  \"Y\": \"a\"\n}"},
+		{[]string{`{"X":1}`}, "{\n  \"X\": 1\n}"},
+		{[]string{"[1,true]"}, "[\n  1,\n  true\n]"},
+	}
+	for _, test := range tests {
+		params, err := parseParams(test.args)
+		if err != nil {
+			t.Fatalf("%v: %s", test.args, err)
+		}
+		if got := formatJSON(params); got != test.expected {
+			t.Fatalf("%v: got %s, expected %s", test.args, got, test.expected)
+		}
+	}
+	if _, err := parseParams([]string{"X=1", "2"}); err == nil {
+		t.Fatal("expected error mixing key=value pairs and values")
+	}
+}
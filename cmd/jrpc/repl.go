@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+// Maximum number of lines kept in history file
+const historySize = 1000
+
+// Commands available in REPL besides calling methods directly
+var replCommands = []string{"call", "notify", "subscribe", "unsubscribe", "methods", "help", "exit"}
+
+const replHelp = `  METHOD [PARAMS...]            call method and print result
+  call METHOD [PARAMS...]       the same as above
+  notify METHOD [PARAMS...]     send notification
+  subscribe METHOD [PARAMS...]  print subscription messages as they arrive
+  unsubscribe METHOD            stop subscription
+  methods                       list discovered methods
+  help                          show this help
+  exit                          quit (Ctrl-D)
+PARAMS is a json array or object, key=value pairs or values.
+`
+
+// Interactive session state
+type session struct {
+	client  *client.Client
+	editor  *lineEditor
+	methods []string
+
+	// Active subscriptions by method name
+	subscriptions map[string]*client.Subscription
+	lock          sync.Mutex
+}
+
+// Runs REPL until exit, Ctrl-D or connection close
+func repl(c *client.Client) error {
+	fd := int(os.Stdin.Fd())
+	raw := isTerminal(fd)
+	if raw {
+		restore, err := makeRaw(fd)
+		if err != nil {
+			raw = false
+		} else {
+			defer restore()
+		}
+	}
+	s := &session{
+		client:        c,
+		editor:        newLineEditor(os.Stdin, os.Stdout, "jrpc> ", raw),
+		subscriptions: map[string]*client.Subscription{},
+	}
+	s.editor.complete = s.complete
+	defer s.editor.Close()
+	s.discover()
+
+	history := historyPath()
+	if raw && history != "" {
+		s.editor.loadHistory(history)
+		defer s.editor.saveHistory(history, historySize)
+	}
+	go func() {
+		<-c.Done()
+		s.editor.Printf("connection closed: %v\n", c.Conn.Err())
+	}()
+
+	s.editor.Printf("connected, %d methods discovered. Type help for commands.\n", len(s.methods))
+	for {
+		line, err := s.editor.ReadLine()
+		switch {
+		case errors.Is(err, errInterrupt):
+			continue
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		select {
+		case <-c.Done():
+			return c.Conn.Err()
+		default:
+		}
+		if s.exec(strings.TrimSpace(line)) {
+			return nil
+		}
+	}
+}
+
+// Executes REPL line. Returns true on exit.
+func (s *session) exec(line string) bool {
+	if line == "" {
+		return false
+	}
+	command, rest, _ := strings.Cut(line, " ")
+	switch command {
+	case "exit", "quit":
+		return true
+	case "help":
+		s.editor.Printf(replHelp)
+		return false
+	case "methods":
+		s.editor.Printf("%s\n", strings.Join(s.methods, "\n"))
+		return false
+	case "call", "notify", "subscribe", "unsubscribe":
+		line = strings.TrimSpace(rest)
+	default:
+		command = "call"
+	}
+	method, rest, _ := strings.Cut(line, " ")
+	if method == "" {
+		s.editor.Printf("error: missing method\n")
+		return false
+	}
+	params, err := parseParams(splitArgs(rest))
+	if err != nil {
+		s.editor.Printf("%s\n", formatError(err))
+		return false
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "call":
+		var result interface{}
+		start := time.Now()
+		if err := s.client.Call(ctx, method, params, &result); err != nil {
+			s.editor.Printf("%s\n", formatError(err))
+			return false
+		}
+		s.editor.Printf("%s\n(%s)\n", formatJSON(result), time.Since(start).Round(time.Microsecond))
+	case "notify":
+		if err := s.client.Notify(ctx, method, params); err != nil {
+			s.editor.Printf("%s\n", formatError(err))
+		}
+	case "subscribe":
+		s.subscribe(method, params)
+	case "unsubscribe":
+		s.lock.Lock()
+		sub, ok := s.subscriptions[method]
+		s.lock.Unlock()
+		if !ok {
+			s.editor.Printf("error: not subscribed to %s\n", method)
+			return false
+		}
+		if err := sub.Unsubscribe(ctx); err != nil {
+			s.editor.Printf("%s\n", formatError(err))
+		}
+	}
+	return false
+}
+
+// Subscribes and prints messages in background
+func (s *session) subscribe(method string, params interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.subscriptions[method]; ok {
+		s.editor.Printf("error: already subscribed to %s\n", method)
+		return
+	}
+	sub, err := s.client.Subscribe(context.Background(), method, params)
+	if err != nil {
+		s.editor.Printf("%s\n", formatError(err))
+		return
+	}
+	s.subscriptions[method] = sub
+	go func() {
+		for msg := range sub.C {
+			s.editor.Printf("[%s] %s\n", method, formatJSON(msg))
+		}
+		s.lock.Lock()
+		delete(s.subscriptions, method)
+		s.lock.Unlock()
+		if err := sub.Err(); err != nil && !errors.Is(err, client.ErrUnsubscribed) {
+			s.editor.Printf("[%s] %s\n", method, formatError(err))
+		} else {
+			s.editor.Printf("[%s] ended\n", method)
+		}
+	}()
+}
+
+// Loads method names using "rpc.Discover". Servers without discovery are
+// used without completion.
+func (s *session) discover() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	doc := openrpc.Document{}
+	if err := s.client.Call(ctx, "rpc.Discover", nil, &doc); err != nil {
+		s.editor.Printf("discovery failed: %s\n", formatError(err))
+		return
+	}
+	methods := []string{"rpc.Discover", "rpc.Quota"}
+	for _, m := range doc.Methods {
+		methods = append(methods, m.Name)
+		if m.XUnsubscribe != "" {
+			methods = append(methods, m.XUnsubscribe)
+		}
+	}
+	sort.Strings(methods)
+	s.methods = methods
+}
+
+// Completes command in the first word and method name in the first word
+// or after a command
+func (s *session) complete(line []rune, pos int) []string {
+	words := strings.Fields(string(line[:pos]))
+	if pos > 0 && line[pos-1] == ' ' {
+		words = append(words, "")
+	}
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	word := words[len(words)-1]
+	candidates := []string{}
+	switch {
+	case len(words) == 1:
+		candidates = append(candidates, replCommands...)
+		candidates = append(candidates, s.methods...)
+	case len(words) == 2 && contains(replCommands[:4], words[0]):
+		candidates = s.methods
+	}
+	result := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Splits params respecting quotes. Json array or object is kept as one arg.
+func splitArgs(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		return []string{s}
+	}
+	args := []string{}
+	current := &strings.Builder{}
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// Returns path of history file in home directory
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".jrpc_history")
+}
+
+// Checks if list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Command jrpcgen generates typed Go or TypeScript clients from OpenRPC
+// document produced by Registry.Document. Document is read from a file or
+// from a running server using "rpc.Discover" method.
+//
+//	jrpcgen -url ws://localhost:3333/ws -pkg exampleclient -out client_gen.go
+//	jrpcgen -in openrpc.json -pkg exampleclient -out client_gen.go
+//	jrpcgen -url ws://localhost:3333/ws -lang ts -out web/src/jrpc.ts
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/codegen"
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+func main() {
+	in := flag.String("in", "", "OpenRPC document file, \"-\" reads stdin")
+	url := flag.String("url", "", "websocket url of running server to discover methods from")
+	lang := flag.String("lang", "go", "language of generated client: go or ts")
+	pkg := flag.String("pkg", "jrpcclient", "package name of generated Go code")
+	out := flag.String("out", "", "output file, stdout when empty")
+	services := flag.String("services", "", "comma separated services to generate, all when empty")
+	flag.Parse()
+
+	doc, err := load(*in, *url)
+	if err != nil {
+		fail(err)
+	}
+	if *services != "" {
+		filter(doc, strings.Split(*services, ","))
+	}
+	var src []byte
+	switch *lang {
+	case "go":
+		src, err = codegen.Go(doc, *pkg)
+	case "ts":
+		src, err = codegen.TypeScript(doc)
+	default:
+		err = fmt.Errorf("unsupported language %s", *lang)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fail(err)
+	}
+}
+
+// Loads OpenRPC document from file or running server
+func load(in, url string) (*openrpc.Document, error) {
+	doc := &openrpc.Document{}
+	switch {
+	case in == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return doc, json.Unmarshal(data, doc)
+	case in != "":
+		data, err := os.ReadFile(in)
+		if err != nil {
+			return nil, err
+		}
+		return doc, json.Unmarshal(data, doc)
+	case url != "":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		c, err := client.Dial(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return doc, c.Call(ctx, "rpc.Discover", nil, doc)
+	}
+	return nil, fmt.Errorf("either -in or -url is required")
+}
+
+// Keeps only methods of provided services
+func filter(doc *openrpc.Document, services []string) {
+	methods := []openrpc.Method{}
+	for _, m := range doc.Methods {
+		for _, s := range services {
+			if strings.HasPrefix(m.Name, strings.TrimSpace(s)+".") {
+				methods = append(methods, m)
+				break
+			}
+		}
+	}
+	doc.Methods = methods
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "jrpcgen:", err)
+	os.Exit(1)
+}
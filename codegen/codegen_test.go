@@ -0,0 +1,163 @@
+package codegen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc/codegen"
+	"github.com/kroksys/jrpc/openrpc"
+	"github.com/kroksys/jrpc/registry"
+)
+
+// Golden files are written instead of compared when tests run with -update
+var update = flag.Bool("update", false, "update golden files")
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Shape struct {
+	Name    string            `json:"name"`
+	Center  Point             `json:"center"`
+	Inner   *Point            `json:"inner,omitempty"`
+	Points  []Point           `json:"points"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Created time.Time         `json:"created"`
+	Data    []byte            `json:"data,omitempty"`
+	Parent  *Shape            `json:"parent,omitempty"`
+	Scale   *float64          `json:"scale"`
+}
+
+type Shapes struct{}
+
+func (Shapes) Get(name string) (*Shape, error) {
+	return nil, nil
+}
+
+func (Shapes) Create(s Shape) error {
+	return nil
+}
+
+func (Shapes) Move(p Point, dx, dy int) Point {
+	return Point{X: p.X + dx, Y: p.Y + dy}
+}
+
+func (Shapes) Nearest(p *Point) (*Point, error) {
+	return p, nil
+}
+
+func (Shapes) Count() int {
+	return 0
+}
+
+func (Shapes) Moves(sub *registry.Subscription, name string) error {
+	return nil
+}
+
+// Document of Shapes service registered in nested namespace with a topic
+func shapesDocument(t *testing.T) *openrpc.Document {
+	t.Helper()
+	reg, err := registry.NewRegistry(registry.WithInfo("shapes", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("draw.shapes", Shapes{}, registry.Payload("Moves", Point{})); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterTopic("draw.created", nil); err != nil {
+		t.Fatal(err)
+	}
+	return reg.Document()
+}
+
+// Compares got with golden file or writes it when tests run with -update
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs, run with -update and check the diff\ngot:\n%s", path, got)
+	}
+}
+
+// Runs command and fails the test with its output
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %v: %s\n%s", name, args, err, out)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	doc := shapesDocument(t)
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "testdata/openrpc.json", append(data, '\n'))
+
+	// Document read by jrpcgen generates the same code
+	parsed := &openrpc.Document{}
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatal(err)
+	}
+	for _, gen := range []func(*openrpc.Document) ([]byte, error){
+		func(d *openrpc.Document) ([]byte, error) { return codegen.Go(d, "shapesclient") },
+		codegen.TypeScript,
+	} {
+		want, err := gen(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := gen(parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("code generated from parsed document differs")
+		}
+	}
+}
+
+func TestGo(t *testing.T) {
+	src, err := codegen.Go(shapesDocument(t), "shapesclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "testdata/shapesclient/client.go", src)
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	run(t, "go", "vet", "./testdata/shapesclient")
+}
+
+func TestTypeScript(t *testing.T) {
+	src, err := codegen.TypeScript(shapesDocument(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "testdata/client.ts", src)
+	if _, err := exec.LookPath("tsc"); err != nil {
+		t.Skip("tsc not found, install typescript to check generated client")
+	}
+	run(t, "tsc", "--noEmit", "--strict", "--target", "es2020", "--lib", "es2020,dom", "testdata/client.ts")
+}
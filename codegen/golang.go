@@ -0,0 +1,297 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+// Basic Go types kept as they are when found in x-go-type
+var goBasicTypes = map[string]bool{
+	"bool": true, "string": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// Generates Go source of a typed client for methods described in OpenRPC
+// document. Every call gets a method named after service and method
+// ("example.Simple" => ExampleSimple) and every subscription gets a method
+// returning typed chanel ("example.subscribe.Time" => SubscribeExampleTime).
+func Go(doc *openrpc.Document, pkg string) ([]byte, error) {
+	g := &goGen{doc: doc}
+	body := &bytes.Buffer{}
+	for _, m := range doc.Methods {
+		if err := g.method(body, m); err != nil {
+			return nil, err
+		}
+	}
+	types := &bytes.Buffer{}
+	for _, name := range sortedNames(doc) {
+		g.component(types, name)
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by jrpcgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(out, "package %s\n\n", pkg)
+	fmt.Fprintf(out, "import (\n\t\"context\"\n")
+	if g.usesTime {
+		fmt.Fprintf(out, "\t\"time\"\n")
+	}
+	fmt.Fprintf(out, "\n\t\"github.com/kroksys/jrpc/client\"\n)\n\n")
+	fmt.Fprintf(out, "// Client calls methods of %s %s\n", doc.Info.Title, doc.Info.Version)
+	fmt.Fprintf(out, "type Client struct {\n\t*client.Client\n}\n\n")
+	fmt.Fprintf(out, "// Creates typed client using connected client\n")
+	fmt.Fprintf(out, "func New(c *client.Client) *Client {\n\treturn &Client{Client: c}\n}\n\n")
+	fmt.Fprintf(out, "// Connects to the server and creates typed client\n")
+	fmt.Fprintf(out, "func Dial(ctx context.Context, url string, opts ...client.Option) (*Client, error) {\n")
+	fmt.Fprintf(out, "\tc, err := client.Dial(ctx, url, opts...)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	fmt.Fprintf(out, "\treturn New(c), nil\n}\n\n")
+	out.Write(body.Bytes())
+	out.Write(types.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return out.Bytes(), fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// Go code generator state
+type goGen struct {
+	doc      *openrpc.Document
+	usesTime bool
+}
+
+// Writes client method for a call or subscription
+func (g *goGen) method(w *bytes.Buffer, m openrpc.Method) error {
+	service, method, ok := splitMethod(m.Name)
+	if !ok {
+		return fmt.Errorf("invalid method name %s", m.Name)
+	}
+	args, params := g.params(m)
+	if m.XSubscription {
+		name := "Subscribe" + exportName(service) + exportName(method)
+		payload := "interface{}"
+		if m.Result != nil {
+			payload = g.goType(m.Result.Schema)
+		}
+		fmt.Fprintf(w, "// Subscribes to %q. Messages are received until unsubscribed with\n", m.Name)
+		fmt.Fprintf(w, "// Subscription.Unsubscribe or the subscription ends.\n")
+		fmt.Fprintf(w, "func (c *Client) %s(%s) (<-chan %s, *client.Subscription, error) {\n", name, args, payload)
+		fmt.Fprintf(w, "\tsub, err := c.Subscribe(ctx, %q, %s)\n", m.Name, params)
+		fmt.Fprintf(w, "\tif err != nil {\n\t\treturn nil, nil, err\n\t}\n")
+		if m.XTopic {
+			fmt.Fprintf(w, "\tif err := sub.WaitSubscribed(ctx); err != nil {\n\t\treturn nil, nil, err\n\t}\n")
+		}
+		fmt.Fprintf(w, "\treturn client.Messages[%s](sub), sub, nil\n}\n\n", payload)
+		return nil
+	}
+
+	name := exportName(service) + exportName(method)
+	fmt.Fprintf(w, "// Calls %q\n", m.Name)
+	if m.Result == nil {
+		fmt.Fprintf(w, "func (c *Client) %s(%s) error {\n", name, args)
+		fmt.Fprintf(w, "\treturn c.Call(ctx, %q, %s, nil)\n}\n\n", m.Name, params)
+		return nil
+	}
+	result := g.goType(m.Result.Schema)
+	fmt.Fprintf(w, "func (c *Client) %s(%s) (%s, error) {\n", name, args, result)
+	fmt.Fprintf(w, "\tvar result %s\n", result)
+	fmt.Fprintf(w, "\terr := c.Call(ctx, %q, %s, &result)\n", m.Name, params)
+	fmt.Fprintf(w, "\treturn result, err\n}\n\n")
+	return nil
+}
+
+// Returns method arguments and params expression sent with the request
+func (g *goGen) params(m openrpc.Method) (string, string) {
+	args := []string{"ctx context.Context"}
+	switch {
+	case m.XTopic:
+		return "ctx context.Context, params interface{}", "params"
+	case m.ParamStructure == openrpc.ByName && m.XParams != nil:
+		return "ctx context.Context, params " + g.goType(m.XParams), "params"
+	case len(m.Params) == 0:
+		return "ctx context.Context", "nil"
+	}
+	names := []string{}
+	for i, p := range m.Params {
+		name := paramName(p.Name, i)
+		args = append(args, name+" "+g.goType(p.Schema))
+		names = append(names, name)
+	}
+	return strings.Join(args, ", "), "[]interface{}{" + strings.Join(names, ", ") + "}"
+}
+
+// Writes struct type of a component schema
+func (g *goGen) component(w *bytes.Buffer, name string) {
+	s := g.doc.Components.Schemas[name]
+	if s.Type != "object" || s.Properties == nil {
+		fmt.Fprintf(w, "type %s = %s\n\n", exportName(name), g.goType(s))
+		return
+	}
+	if s.XGoType != "" {
+		fmt.Fprintf(w, "// %s mirrors %s\n", exportName(name), s.XGoType)
+	}
+	fmt.Fprintf(w, "type %s %s\n\n", exportName(name), g.structType(s))
+}
+
+// Returns struct type with fields of object schema
+func (g *goGen) structType(s *openrpc.Schema) string {
+	b := &strings.Builder{}
+	b.WriteString("struct {\n")
+	keys := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tag := k
+		if !contains(s.Required, k) {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", exportName(k), g.goType(s.Properties[k]), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// Returns Go type of a schema
+func (g *goGen) goType(s *openrpc.Schema) string {
+	if s == nil {
+		return "interface{}"
+	}
+	var t string
+	if s.Ref != "" {
+		t = exportName(openrpc.RefName(s.Ref))
+	} else {
+		t = g.baseType(s)
+	}
+	if s.Nullable && t != "interface{}" && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") {
+		return "*" + t
+	}
+	return t
+}
+
+// Returns Go type of a schema ignoring nullable
+func (g *goGen) baseType(s *openrpc.Schema) string {
+	switch {
+	case goBasicTypes[s.XGoType]:
+		return s.XGoType
+	case s.Format == "date-time":
+		g.usesTime = true
+		return "time.Time"
+	case s.Format == "byte":
+		return "[]byte"
+	}
+	switch s.Type {
+	case "boolean":
+		return "bool"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "string":
+		return "string"
+	case "array":
+		return "[]" + g.goType(s.Items)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties)
+		}
+		if len(s.Properties) > 0 {
+			return g.structType(s)
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// Returns component names in sorted order
+func sortedNames(doc *openrpc.Document) []string {
+	names := []string{}
+	if doc.Components == nil {
+		return names
+	}
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns valid Go parameter name
+func paramName(name string, i int) string {
+	id := identifier(name)
+	if id == "" || token.IsKeyword(id) || id == "ctx" || id == "c" || id == "params" || id == "result" || id == "err" || id == "sub" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	return strings.ToLower(id[:1]) + id[1:]
+}
+
+// Converts name to exported Go identifier, i.e. "user_id" => "UserId"
+func exportName(name string) string {
+	id := identifier(name)
+	if id == "" {
+		return "X"
+	}
+	if id[0] >= '0' && id[0] <= '9' {
+		id = "X" + id
+	}
+	return strings.ToUpper(id[:1]) + id[1:]
+}
+
+// Splits method name into service and method or subscription name, i.e.
+// "example.subscribe.Time" => "example", "Time". Parts can be separated
+// with ".", "/" or "_". Service of a subscription may be a nested
+// namespace, i.e. "billing.invoices.subscribe.Created".
+func splitMethod(name string) (string, string, bool) {
+	for _, sep := range []string{".", "/", "_"} {
+		parts := strings.Split(name, sep)
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		for i := 1; i < len(parts)-1; i++ {
+			if strings.EqualFold(parts[i], "subscribe") || strings.EqualFold(parts[i], "unsubscribe") {
+				return strings.Join(parts[:i], sep), strings.Join(parts[i+1:], sep), true
+			}
+		}
+		return parts[0], strings.Join(parts[1:], sep), true
+	}
+	return "", "", false
+}
+
+// Removes characters not allowed in identifiers and capitalises words
+// separated by them
+func identifier(name string) string {
+	b := &strings.Builder{}
+	upper := false
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			if upper && r >= 'a' && r <= 'z' {
+				r -= 'a' - 'A'
+			}
+			b.WriteRune(r)
+			upper = false
+		default:
+			upper = b.Len() > 0
+		}
+	}
+	return b.String()
+}
+
+// Checks if list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Code generated by jrpcgen. DO NOT EDIT.
+// Client of shapes 1.0.0
+
+// Mirrors codegen_test.Point
+export interface Point {
+  x: number;
+  y: number;
+}
+
+// Mirrors codegen_test.Shape
+export interface Shape {
+  center: Point;
+  created: string;
+  data?: string;
+  inner?: Point | null;
+  name: string;
+  parent?: Shape | null;
+  points: Point[];
+  scale?: number | null;
+  tags?: Record<string, string>;
+}
+
+export class RpcError extends Error {
+  constructor(public code: number, message: string, public data?: unknown) {
+    super(data === undefined ? message : message + ": " + JSON.stringify(data));
+  }
+}
+
+interface Pending {
+  resolve(result: unknown): void;
+  reject(err: unknown): void;
+}
+
+// Subscription receives messages until unsubscribed or ended by the server.
+// for await (const msg of sub) { ... }
+export class Subscription<T> implements AsyncIterable<T> {
+  private queue: T[] = [];
+  private waiting: Pending[] = [];
+  private done = false;
+  private error: unknown;
+
+  constructor(private client: JrpcClient, readonly id: string, private unsubscribeMethod: string) {}
+
+  async unsubscribe(): Promise<void> {
+    this.end();
+    await this.client.call(this.unsubscribeMethod);
+  }
+
+  push(msg: T): void {
+    const w = this.waiting.shift();
+    if (w) {
+      w.resolve({ value: msg, done: false });
+    } else {
+      this.queue.push(msg);
+    }
+  }
+
+  end(err?: unknown): void {
+    if (this.done) {
+      return;
+    }
+    this.done = true;
+    this.error = err;
+    for (const w of this.waiting.splice(0)) {
+      if (err === undefined) {
+        w.resolve({ value: undefined, done: true });
+      } else {
+        w.reject(err);
+      }
+    }
+  }
+
+  [Symbol.asyncIterator](): AsyncIterator<T> {
+    return {
+      next: () => {
+        if (this.queue.length > 0) {
+          return Promise.resolve({ value: this.queue.shift() as T, done: false });
+        }
+        if (this.done) {
+          return this.error === undefined
+            ? Promise.resolve({ value: undefined, done: true })
+            : Promise.reject(this.error);
+        }
+        return new Promise((resolve, reject) => this.waiting.push({ resolve: resolve as (r: unknown) => void, reject }));
+      },
+      return: () => {
+        this.unsubscribe().catch(() => undefined);
+        return Promise.resolve({ value: undefined, done: true });
+      },
+    };
+  }
+}
+
+export class JrpcClient {
+  private lastId = 0;
+  private pending = new Map<string, Pending>();
+  private subscriptions = new Map<string, Subscription<unknown>>();
+  private skipConfirmation = new Set<string>();
+  protected opened: Promise<void>;
+
+  constructor(readonly ws: WebSocket) {
+    this.opened = new Promise((resolve, reject) => {
+      if (ws.readyState === WebSocket.OPEN) {
+        resolve();
+        return;
+      }
+      ws.addEventListener("open", () => resolve(), { once: true });
+      ws.addEventListener("error", (e) => reject(e), { once: true });
+    });
+    ws.addEventListener("message", (e) => this.handle(e.data));
+    ws.addEventListener("close", () => this.closed(new Error("connection closed")));
+  }
+
+  static connect<C extends JrpcClient>(
+    this: new (ws: WebSocket) => C,
+    url: string,
+    protocols?: string | string[],
+  ): Promise<C> {
+    const c = new this(new WebSocket(url, protocols));
+    return c.opened.then(() => c);
+  }
+
+  async call<T = unknown>(method: string, params?: unknown): Promise<T> {
+    await this.opened;
+    const id = String(++this.lastId);
+    return new Promise<T>((resolve, reject) => {
+      this.pending.set(id, { resolve: resolve as (r: unknown) => void, reject });
+      this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params, id }));
+    });
+  }
+
+  async notify(method: string, params?: unknown): Promise<void> {
+    await this.opened;
+    this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params }));
+  }
+
+  subscribe<T = unknown>(method: string, unsubscribeMethod: string, params?: unknown, topic = false): Subscription<T> {
+    const id = "sub-" + ++this.lastId;
+    const sub = new Subscription<T>(this, id, unsubscribeMethod);
+    this.subscriptions.set(id, sub as Subscription<unknown>);
+    if (topic) {
+      this.skipConfirmation.add(id);
+    }
+    this.opened
+      .then(() => this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params, id })))
+      .catch((err) => sub.end(err));
+    return sub;
+  }
+
+  close(): void {
+    this.ws.close();
+  }
+
+  private handle(data: string): void {
+    // eslint-disable-next-line @typescript-eslint/no-explicit-any
+    let msg: any;
+    try {
+      msg = JSON.parse(data);
+    } catch {
+      return;
+    }
+    for (const resp of Array.isArray(msg) ? msg : [msg]) {
+      if (resp && resp.method === undefined && resp.id !== undefined && resp.id !== null) {
+        this.resolve(resp);
+      }
+    }
+  }
+
+  private resolve(resp: { id: unknown; result?: unknown; error?: { code: number; message: string; data?: unknown } }): void {
+    const id = String(resp.id);
+    const sub = this.subscriptions.get(id);
+    if (sub) {
+      if (resp.error) {
+        this.subscriptions.delete(id);
+        sub.end(new RpcError(resp.error.code, resp.error.message, resp.error.data));
+      } else if (resp.result === undefined || resp.result === null) {
+        this.subscriptions.delete(id);
+        sub.end();
+      } else if (this.skipConfirmation.delete(id)) {
+        // Topic subscriptions first receive "subscribed" confirmation
+      } else {
+        sub.push(resp.result);
+      }
+      return;
+    }
+    const p = this.pending.get(id);
+    if (!p) {
+      return;
+    }
+    this.pending.delete(id);
+    if (resp.error) {
+      p.reject(new RpcError(resp.error.code, resp.error.message, resp.error.data));
+    } else {
+      p.resolve(resp.result);
+    }
+  }
+
+  private closed(err: Error): void {
+    for (const p of this.pending.values()) {
+      p.reject(err);
+    }
+    this.pending.clear();
+    for (const sub of this.subscriptions.values()) {
+      sub.end(err);
+    }
+    this.subscriptions.clear();
+  }
+}
+
+export class Client extends JrpcClient {
+  // Calls "draw.shapes.Count"
+  drawShapesCount(): Promise<number> {
+    return this.call<number>("draw.shapes.Count", undefined);
+  }
+
+  // Calls "draw.shapes.Create"
+  drawShapesCreate(params: Shape): Promise<void> {
+    return this.call<void>("draw.shapes.Create", params);
+  }
+
+  // Calls "draw.shapes.Get"
+  drawShapesGet(arg0: string): Promise<Shape | null> {
+    return this.call<Shape | null>("draw.shapes.Get", [arg0]);
+  }
+
+  // Calls "draw.shapes.Move"
+  drawShapesMove(arg0: Point, arg1: number, arg2: number): Promise<Point> {
+    return this.call<Point>("draw.shapes.Move", [arg0, arg1, arg2]);
+  }
+
+  // Calls "draw.shapes.Nearest"
+  drawShapesNearest(params: Point | null): Promise<Point | null> {
+    return this.call<Point | null>("draw.shapes.Nearest", params);
+  }
+
+  // Subscribes to "draw.shapes.subscribe.Moves"
+  subscribeDrawShapesMoves(arg0: string): Subscription<Point> {
+    return this.subscribe<Point>("draw.shapes.subscribe.Moves", "draw.shapes.unsubscribe.Moves", [arg0], false);
+  }
+
+  // Subscribes to "draw.subscribe.created"
+  subscribeDrawCreated(params?: unknown): Subscription<unknown> {
+    return this.subscribe<unknown>("draw.subscribe.created", "draw.unsubscribe.created", params, true);
+  }
+}
@@ -0,0 +1,104 @@
+// Code generated by jrpcgen. DO NOT EDIT.
+
+package shapesclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+)
+
+// Client calls methods of shapes 1.0.0
+type Client struct {
+	*client.Client
+}
+
+// Creates typed client using connected client
+func New(c *client.Client) *Client {
+	return &Client{Client: c}
+}
+
+// Connects to the server and creates typed client
+func Dial(ctx context.Context, url string, opts ...client.Option) (*Client, error) {
+	c, err := client.Dial(ctx, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// Calls "draw.shapes.Count"
+func (c *Client) DrawShapesCount(ctx context.Context) (int, error) {
+	var result int
+	err := c.Call(ctx, "draw.shapes.Count", nil, &result)
+	return result, err
+}
+
+// Calls "draw.shapes.Create"
+func (c *Client) DrawShapesCreate(ctx context.Context, params Shape) error {
+	return c.Call(ctx, "draw.shapes.Create", params, nil)
+}
+
+// Calls "draw.shapes.Get"
+func (c *Client) DrawShapesGet(ctx context.Context, arg0 string) (*Shape, error) {
+	var result *Shape
+	err := c.Call(ctx, "draw.shapes.Get", []interface{}{arg0}, &result)
+	return result, err
+}
+
+// Calls "draw.shapes.Move"
+func (c *Client) DrawShapesMove(ctx context.Context, arg0 Point, arg1 int, arg2 int) (Point, error) {
+	var result Point
+	err := c.Call(ctx, "draw.shapes.Move", []interface{}{arg0, arg1, arg2}, &result)
+	return result, err
+}
+
+// Calls "draw.shapes.Nearest"
+func (c *Client) DrawShapesNearest(ctx context.Context, params *Point) (*Point, error) {
+	var result *Point
+	err := c.Call(ctx, "draw.shapes.Nearest", params, &result)
+	return result, err
+}
+
+// Subscribes to "draw.shapes.subscribe.Moves". Messages are received until unsubscribed with
+// Subscription.Unsubscribe or the subscription ends.
+func (c *Client) SubscribeDrawShapesMoves(ctx context.Context, arg0 string) (<-chan Point, *client.Subscription, error) {
+	sub, err := c.Subscribe(ctx, "draw.shapes.subscribe.Moves", []interface{}{arg0})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.Messages[Point](sub), sub, nil
+}
+
+// Subscribes to "draw.subscribe.created". Messages are received until unsubscribed with
+// Subscription.Unsubscribe or the subscription ends.
+func (c *Client) SubscribeDrawCreated(ctx context.Context, params interface{}) (<-chan interface{}, *client.Subscription, error) {
+	sub, err := c.Subscribe(ctx, "draw.subscribe.created", params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := sub.WaitSubscribed(ctx); err != nil {
+		return nil, nil, err
+	}
+	return client.Messages[interface{}](sub), sub, nil
+}
+
+// Point mirrors codegen_test.Point
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Shape mirrors codegen_test.Shape
+type Shape struct {
+	Center  Point             `json:"center"`
+	Created time.Time         `json:"created"`
+	Data    []byte            `json:"data,omitempty"`
+	Inner   *Point            `json:"inner,omitempty"`
+	Name    string            `json:"name"`
+	Parent  *Shape            `json:"parent,omitempty"`
+	Points  []Point           `json:"points"`
+	Scale   *float64          `json:"scale,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
@@ -0,0 +1,375 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+// Runtime of generated TypeScript module. It has no dependencies and uses
+// WebSocket available in browsers.
+const tsRuntime = `export class RpcError extends Error {
+  constructor(public code: number, message: string, public data?: unknown) {
+    super(data === undefined ? message : message + ": " + JSON.stringify(data));
+  }
+}
+
+interface Pending {
+  resolve(result: unknown): void;
+  reject(err: unknown): void;
+}
+
+// Subscription receives messages until unsubscribed or ended by the server.
+// for await (const msg of sub) { ... }
+export class Subscription<T> implements AsyncIterable<T> {
+  private queue: T[] = [];
+  private waiting: Pending[] = [];
+  private done = false;
+  private error: unknown;
+
+  constructor(private client: JrpcClient, readonly id: string, private unsubscribeMethod: string) {}
+
+  async unsubscribe(): Promise<void> {
+    this.end();
+    await this.client.call(this.unsubscribeMethod);
+  }
+
+  push(msg: T): void {
+    const w = this.waiting.shift();
+    if (w) {
+      w.resolve({ value: msg, done: false });
+    } else {
+      this.queue.push(msg);
+    }
+  }
+
+  end(err?: unknown): void {
+    if (this.done) {
+      return;
+    }
+    this.done = true;
+    this.error = err;
+    for (const w of this.waiting.splice(0)) {
+      if (err === undefined) {
+        w.resolve({ value: undefined, done: true });
+      } else {
+        w.reject(err);
+      }
+    }
+  }
+
+  [Symbol.asyncIterator](): AsyncIterator<T> {
+    return {
+      next: () => {
+        if (this.queue.length > 0) {
+          return Promise.resolve({ value: this.queue.shift() as T, done: false });
+        }
+        if (this.done) {
+          return this.error === undefined
+            ? Promise.resolve({ value: undefined, done: true })
+            : Promise.reject(this.error);
+        }
+        return new Promise((resolve, reject) => this.waiting.push({ resolve: resolve as (r: unknown) => void, reject }));
+      },
+      return: () => {
+        this.unsubscribe().catch(() => undefined);
+        return Promise.resolve({ value: undefined, done: true });
+      },
+    };
+  }
+}
+
+export class JrpcClient {
+  private lastId = 0;
+  private pending = new Map<string, Pending>();
+  private subscriptions = new Map<string, Subscription<unknown>>();
+  private skipConfirmation = new Set<string>();
+  protected opened: Promise<void>;
+
+  constructor(readonly ws: WebSocket) {
+    this.opened = new Promise((resolve, reject) => {
+      if (ws.readyState === WebSocket.OPEN) {
+        resolve();
+        return;
+      }
+      ws.addEventListener("open", () => resolve(), { once: true });
+      ws.addEventListener("error", (e) => reject(e), { once: true });
+    });
+    ws.addEventListener("message", (e) => this.handle(e.data));
+    ws.addEventListener("close", () => this.closed(new Error("connection closed")));
+  }
+
+  static connect<C extends JrpcClient>(
+    this: new (ws: WebSocket) => C,
+    url: string,
+    protocols?: string | string[],
+  ): Promise<C> {
+    const c = new this(new WebSocket(url, protocols));
+    return c.opened.then(() => c);
+  }
+
+  async call<T = unknown>(method: string, params?: unknown): Promise<T> {
+    await this.opened;
+    const id = String(++this.lastId);
+    return new Promise<T>((resolve, reject) => {
+      this.pending.set(id, { resolve: resolve as (r: unknown) => void, reject });
+      this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params, id }));
+    });
+  }
+
+  async notify(method: string, params?: unknown): Promise<void> {
+    await this.opened;
+    this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params }));
+  }
+
+  subscribe<T = unknown>(method: string, unsubscribeMethod: string, params?: unknown, topic = false): Subscription<T> {
+    const id = "sub-" + ++this.lastId;
+    const sub = new Subscription<T>(this, id, unsubscribeMethod);
+    this.subscriptions.set(id, sub as Subscription<unknown>);
+    if (topic) {
+      this.skipConfirmation.add(id);
+    }
+    this.opened
+      .then(() => this.ws.send(JSON.stringify({ jsonrpc: "2.0", method, params, id })))
+      .catch((err) => sub.end(err));
+    return sub;
+  }
+
+  close(): void {
+    this.ws.close();
+  }
+
+  private handle(data: string): void {
+    // eslint-disable-next-line @typescript-eslint/no-explicit-any
+    let msg: any;
+    try {
+      msg = JSON.parse(data);
+    } catch {
+      return;
+    }
+    for (const resp of Array.isArray(msg) ? msg : [msg]) {
+      if (resp && resp.method === undefined && resp.id !== undefined && resp.id !== null) {
+        this.resolve(resp);
+      }
+    }
+  }
+
+  private resolve(resp: { id: unknown; result?: unknown; error?: { code: number; message: string; data?: unknown } }): void {
+    const id = String(resp.id);
+    const sub = this.subscriptions.get(id);
+    if (sub) {
+      if (resp.error) {
+        this.subscriptions.delete(id);
+        sub.end(new RpcError(resp.error.code, resp.error.message, resp.error.data));
+      } else if (resp.result === undefined || resp.result === null) {
+        this.subscriptions.delete(id);
+        sub.end();
+      } else if (this.skipConfirmation.delete(id)) {
+        // Topic subscriptions first receive "subscribed" confirmation
+      } else {
+        sub.push(resp.result);
+      }
+      return;
+    }
+    const p = this.pending.get(id);
+    if (!p) {
+      return;
+    }
+    this.pending.delete(id);
+    if (resp.error) {
+      p.reject(new RpcError(resp.error.code, resp.error.message, resp.error.data));
+    } else {
+      p.resolve(resp.result);
+    }
+  }
+
+  private closed(err: Error): void {
+    for (const p of this.pending.values()) {
+      p.reject(err);
+    }
+    this.pending.clear();
+    for (const sub of this.subscriptions.values()) {
+      sub.end(err);
+    }
+    this.subscriptions.clear();
+  }
+}
+`
+
+// Generates TypeScript client module for methods described in OpenRPC
+// document. Module exports interfaces of component schemas, JrpcClient
+// runtime and Client class with a typed method per call
+// ("example.Simple" => exampleSimple) and subscription
+// ("example.subscribe.Time" => subscribeExampleTime) returning async
+// iterable Subscription.
+func TypeScript(doc *openrpc.Document) ([]byte, error) {
+	g := &tsGen{doc: doc}
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by jrpcgen. DO NOT EDIT.\n")
+	fmt.Fprintf(out, "// Client of %s %s\n\n", doc.Info.Title, doc.Info.Version)
+	for _, name := range sortedNames(doc) {
+		g.component(out, name)
+	}
+	out.WriteString(tsRuntime)
+	fmt.Fprintf(out, "\nexport class Client extends JrpcClient {\n")
+	for _, m := range doc.Methods {
+		if err := g.method(out, m); err != nil {
+			return nil, err
+		}
+	}
+	out.Truncate(out.Len() - 1) // blank line after the last method
+	fmt.Fprintf(out, "}\n")
+	return out.Bytes(), nil
+}
+
+// TypeScript code generator state
+type tsGen struct {
+	doc *openrpc.Document
+}
+
+// Writes interface or type alias of a component schema
+func (g *tsGen) component(w *bytes.Buffer, name string) {
+	s := g.doc.Components.Schemas[name]
+	if s.XGoType != "" {
+		fmt.Fprintf(w, "// Mirrors %s\n", s.XGoType)
+	}
+	if s.Type == "object" && s.Properties != nil {
+		fmt.Fprintf(w, "export interface %s %s\n\n", exportName(name), g.objectType(s, ""))
+		return
+	}
+	fmt.Fprintf(w, "export type %s = %s;\n\n", exportName(name), g.tsType(s))
+}
+
+// Writes typed method for a call or subscription
+func (g *tsGen) method(w *bytes.Buffer, m openrpc.Method) error {
+	service, method, ok := splitMethod(m.Name)
+	if !ok {
+		return fmt.Errorf("invalid method name %s", m.Name)
+	}
+	args, params := g.params(m)
+	if m.XSubscription {
+		name := "subscribe" + exportName(service) + exportName(method)
+		payload := "unknown"
+		if m.Result != nil {
+			payload = g.tsType(m.Result.Schema)
+		}
+		if m.XUnsubscribe == "" {
+			return fmt.Errorf("subscription %s has no unsubscribe method", m.Name)
+		}
+		fmt.Fprintf(w, "  // Subscribes to %q\n", m.Name)
+		fmt.Fprintf(w, "  %s(%s): Subscription<%s> {\n", name, args, payload)
+		fmt.Fprintf(w, "    return this.subscribe<%s>(%q, %q, %s, %t);\n  }\n\n", payload, m.Name, m.XUnsubscribe, params, m.XTopic)
+		return nil
+	}
+	name := lowerFirst(exportName(service)) + exportName(method)
+	result := "void"
+	if m.Result != nil {
+		result = g.tsType(m.Result.Schema)
+	}
+	fmt.Fprintf(w, "  // Calls %q\n", m.Name)
+	fmt.Fprintf(w, "  %s(%s): Promise<%s> {\n", name, args, result)
+	fmt.Fprintf(w, "    return this.call<%s>(%q, %s);\n  }\n\n", result, m.Name, params)
+	return nil
+}
+
+// Returns method arguments and params expression sent with the request
+func (g *tsGen) params(m openrpc.Method) (string, string) {
+	switch {
+	case m.XTopic:
+		return "params?: unknown", "params"
+	case m.ParamStructure == openrpc.ByName && m.XParams != nil:
+		return "params: " + g.tsType(m.XParams), "params"
+	case len(m.Params) == 0:
+		return "", "undefined"
+	}
+	args, names := []string{}, []string{}
+	for i, p := range m.Params {
+		name := paramName(p.Name, i)
+		args = append(args, name+": "+g.tsType(p.Schema))
+		names = append(names, name)
+	}
+	return strings.Join(args, ", "), "[" + strings.Join(names, ", ") + "]"
+}
+
+// Returns object type with properties of schema
+func (g *tsGen) objectType(s *openrpc.Schema, indent string) string {
+	b := &strings.Builder{}
+	b.WriteString("{\n")
+	keys := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		optional := "?"
+		if contains(s.Required, k) {
+			optional = ""
+		}
+		fmt.Fprintf(b, "%s  %s%s: %s;\n", indent, tsPropertyName(k), optional, g.tsType(s.Properties[k]))
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// Returns TypeScript type of a schema
+func (g *tsGen) tsType(s *openrpc.Schema) string {
+	if s == nil {
+		return "unknown"
+	}
+	var t string
+	if s.Ref != "" {
+		t = exportName(openrpc.RefName(s.Ref))
+	} else {
+		t = g.baseType(s)
+	}
+	if s.Nullable && t != "unknown" {
+		return t + " | null"
+	}
+	return t
+}
+
+// Returns TypeScript type of a schema ignoring nullable
+func (g *tsGen) baseType(s *openrpc.Schema) string {
+	switch s.Type {
+	case "boolean":
+		return "boolean"
+	case "integer", "number":
+		return "number"
+	case "string":
+		return "string"
+	case "array":
+		item := g.tsType(s.Items)
+		if strings.Contains(item, " ") {
+			item = "(" + item + ")"
+		}
+		return item + "[]"
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "Record<string, " + g.tsType(s.AdditionalProperties) + ">"
+		}
+		if len(s.Properties) > 0 {
+			return g.objectType(s, "")
+		}
+		return "Record<string, unknown>"
+	}
+	return "unknown"
+}
+
+// Quotes property names that are not valid identifiers
+func tsPropertyName(name string) string {
+	if name != "" && identifier(name) == name && !(name[0] >= '0' && name[0] <= '9') {
+		return name
+	}
+	return fmt.Sprintf("%q", name)
+}
+
+// Lowercases first letter of name
+func lowerFirst(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
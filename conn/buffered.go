@@ -0,0 +1,30 @@
+package conn
+
+import (
+	"bufio"
+	"net"
+)
+
+// Returns connection that reads data buffered by br first. ws.Dial returns
+// non-nil reader when the server sent frames right after handshake, i.e.
+//
+//	cn, br, _, err := ws.Dial(ctx, url)
+//	c := conn.NewClientConn(conn.Buffered(cn, br), conn.DefaultConfig())
+//
+// Returns c when br is nil.
+func Buffered(c net.Conn, br *bufio.Reader) net.Conn {
+	if br == nil {
+		return c
+	}
+	return bufferedConn{Conn: c, r: br}
+}
+
+// net.Conn reading data buffered during handshake first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -1,83 +1,542 @@
 package conn
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/google/uuid"
+	"github.com/kroksys/jrpc/spec"
+	"github.com/kroksys/pool"
 )
 
-// Websocket connection wrapper to handle JsonRpc communication
+const (
+	DefaultWriteTimeout = time.Second * 10
+	DefaultQueueSize    = 256
+
+	// Control frames (ping, pong) waiting to be written
+	controlQueueSize = 8
+)
+
+// Close status codes sent in close frame. See RFC 6455 section 7.4.1
+const (
+	StatusNormal          = ws.StatusNormalClosure
+	StatusGoingAway       = ws.StatusGoingAway
+	StatusPolicyViolation = ws.StatusPolicyViolation
+	StatusMessageTooBig   = ws.StatusMessageTooBig
+)
+
+var (
+	ErrClosed        = errors.New("cant send data to connection: connection is not running anymore")
+	ErrQueueFull     = errors.New("cant send data to connection: write queue is full")
+	ErrMessageTooBig = errors.New("message exceeds maximum message size")
+)
+
+// Config holds connection settings
+type Config struct {
+	// Maximum time for writing a single frame. Zero means no deadline.
+	WriteTimeout time.Duration
+
+	// Number of outgoing messages waiting to be written. When the queue
+	// is full Send returns ErrQueueFull.
+	QueueSize int
+
+	// Maximum size of received message in bytes. Connection is closed with
+	// "message too big" status when exceeded. Zero means no limit.
+	MaxMessageSize int64
+
+	// Maximum size of a single received frame in bytes. When not set
+	// MaxMessageSize is used. Zero means no limit.
+	MaxFrameSize int64
+
+	// Time to wait for response to a request sent with Request when
+	// context has no deadline. Zero means wait until context is done.
+	RequestTimeout time.Duration
+
+	// Codec used to encode requests sent with Request
+	Codec spec.Codec
+
+	// Called with every data message received (inbound is true) and
+	// queued for sending, i.e. to record traffic. Called from reading and
+	// sending gorutines, so it must be safe for concurrent use.
+	OnMessage func(c *Conn, inbound bool, msg []byte)
+}
+
+// Returns Config with default values
+func DefaultConfig() Config {
+	return Config{
+		WriteTimeout:   DefaultWriteTimeout,
+		QueueSize:      DefaultQueueSize,
+		RequestTimeout: DefaultRequestTimeout,
+		Codec:          spec.DefaultCodec,
+	}
+}
+
+// CloseError describes why connection was closed with a close frame
+type CloseError struct {
+	Code   ws.StatusCode
+	Reason string
+
+	// True when close frame was received from the client
+	Remote bool
+}
+
+func (e CloseError) Error() string {
+	if e.Remote {
+		return fmt.Sprintf("connection closed by client: %d %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("connection closed: %d %s", e.Code, e.Reason)
+}
+
+// Websocket frame waiting to be written
+type frame struct {
+	op      ws.OpCode
+	payload []byte
+}
+
+// Websocket connection wrapper to handle JsonRpc communication.
+// All writes are done by a single writer gorutine so frames are never
+// interleaved. Control frames (ping, pong) are written before
+// queued messages.
+//
+// Lifecycle: Close cancels Context and closes Exit, then the writer flushes
+// queued messages and close frame, closes the net.Conn and closes Done.
+// Queued messages are dropped when closed on error or with CloseNow. In is
+// closed by the reading gorutine once it stops.
 type Conn struct {
 	ID        string
 	c         net.Conn
 	In        chan []byte
 	Exit      chan interface{}
 	closeOnce sync.Once
+
+	config  Config
+	state   ws.State
+	out     chan frame
+	control chan frame
+
+	// Close frame and whether queued messages are written before it.
+	// Set before Exit is closed.
+	closeFrame   frame
+	flushOnClose bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan interface{}
+
+	// Close cause and disconnect hooks
+	err     error
+	hooks   []func(*Conn, error)
+	errLock sync.Mutex
+
+	// Unix nano timestamps of last received frame, pong and data message
+	lastRead    int64
+	lastPong    int64
+	lastMessage int64
+
+	// Authenticated principal (user, api key) of the connection
+	principal atomic.Value
+
+	// Subprotocol negotiated during upgrade
+	protocol atomic.Value
+
+	// Requests sent to the client waiting for response
+	pending       *pool.PoolStr[chan spec.Response]
+	lastRequestID uint64
 }
 
+// Creates new Conn with default config
 func NewConn(c net.Conn) *Conn {
+	return NewConnConfig(c, DefaultConfig())
+}
+
+// Creates new Conn with provided config and starts reading and writing
+// gorutines.
+func NewConnConfig(c net.Conn, config Config) *Conn {
+	return newConn(c, config, ws.StateServerSide)
+}
+
+// Creates new Conn for the client side of a connection. Frames written by
+// the client are masked as required by RFC 6455.
+func NewClientConn(c net.Conn, config Config) *Conn {
+	return newConn(c, config, ws.StateClientSide)
+}
+
+// Creates new Conn working on the given side of connection
+func newConn(c net.Conn, config Config, state ws.State) *Conn {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.Codec == nil {
+		config.Codec = spec.DefaultCodec
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	conn := Conn{
-		ID:   uuid.NewString(),
-		c:    c,
-		In:   make(chan []byte),
-		Exit: make(chan interface{}),
+		ID:      uuid.NewString(),
+		c:       c,
+		In:      make(chan []byte),
+		Exit:    make(chan interface{}),
+		config:  config,
+		state:   state,
+		out:     make(chan frame, config.QueueSize),
+		control: make(chan frame, controlQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan interface{}),
+		pending: pool.NewPoolStr[chan spec.Response](),
 	}
+	now := time.Now().UnixNano()
+	conn.lastRead, conn.lastPong, conn.lastMessage = now, now, now
 	conn.GoRead()
+	conn.goWrite()
 	return &conn
 }
 
+// Context is canceled when connection starts closing
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Done is closed when connection is fully closed: close frame is written
+// and underlying net.Conn is closed.
+func (c *Conn) Done() <-chan interface{} {
+	return c.done
+}
+
+// Returns cause of connection close or nil while connection is running.
+// When closed with close frame the cause is CloseError, otherwise it is the
+// read or write error that terminated the connection.
+func (c *Conn) Err() error {
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	return c.err
+}
+
+// Adds disconnect hook called once when connection is fully closed.
+// If connection is already closed hook is called immediately.
+func (c *Conn) OnClose(fn func(c *Conn, err error)) {
+	c.errLock.Lock()
+	select {
+	case <-c.done:
+		c.errLock.Unlock()
+		fn(c, c.Err())
+		return
+	default:
+	}
+	c.hooks = append(c.hooks, fn)
+	c.errLock.Unlock()
+}
+
+// Sets authenticated principal of the connection (i.e. user ID). It is used
+// to apply limits across all connections of the same principal.
+func (c *Conn) SetPrincipal(principal string) {
+	c.principal.Store(principal)
+}
+
+// Returns authenticated principal or empty string if not set
+func (c *Conn) Principal() string {
+	principal, _ := c.principal.Load().(string)
+	return principal
+}
+
+// Sets subprotocol negotiated during upgrade
+func (c *Conn) SetProtocol(protocol string) {
+	c.protocol.Store(protocol)
+}
+
+// Returns negotiated subprotocol or empty string if none
+func (c *Conn) Protocol() string {
+	protocol, _ := c.protocol.Load().(string)
+	return protocol
+}
+
+// Time when any frame (including pong) was last received
+func (c *Conn) LastRead() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastRead))
+}
+
+// Time when pong was last received
+func (c *Conn) LastPong() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastPong))
+}
+
+// Time when data message was last received
+func (c *Conn) LastMessage() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastMessage))
+}
+
 // Sends ping message to the connection
 func (c *Conn) Ping() {
 	if !c.isRunning() {
 		return
 	}
-	err := wsutil.WriteServerMessage(c.c, ws.OpPing, ws.CompiledPing)
-	if err != nil {
-		c.Close()
-		return
-	}
+	c.sendControl(frame{op: ws.OpPing})
 }
 
-// Closes connection and its channels
+// Closes connection with normal closure status. Queued messages are
+// written before close frame.
 func (c *Conn) Close() {
+	c.CloseWith(StatusNormal, "")
+}
+
+// Closes connection sending close frame with provided status code and
+// reason. Queued messages are written before close frame within
+// WriteTimeout.
+func (c *Conn) CloseWith(code ws.StatusCode, reason string) {
+	c.closeWith(code, reason, CloseError{Code: code, Reason: reason}, true)
+}
+
+// Closes connection sending close frame with provided status code and
+// reason. Queued messages are dropped, i.e. when the other side stopped
+// responding.
+func (c *Conn) CloseNow(code ws.StatusCode, reason string) {
+	c.closeWith(code, reason, CloseError{Code: code, Reason: reason}, false)
+}
+
+// Records close cause, queues close frame and signals all gorutines to stop.
+// Only the first call has an effect.
+func (c *Conn) closeWith(code ws.StatusCode, reason string, cause error, flush bool) {
 	c.closeOnce.Do(func() {
-		wsutil.WriteServerMessage(c.c, ws.OpClose, nil)
+		c.errLock.Lock()
+		c.err = cause
+		c.errLock.Unlock()
+		c.closeFrame = frame{op: ws.OpClose, payload: ws.NewCloseFrameBody(code, reason)}
+		c.flushOnClose = flush
+		c.cancel()
 		close(c.Exit)
-		close(c.In)
 	})
 }
 
-// gorutine for reading messages from connection
+// Closes connection because of read or write error
+func (c *Conn) closeOnError(err error) {
+	var closed wsutil.ClosedError
+	var protocolErr ws.ProtocolError
+	switch {
+	case errors.As(err, &closed):
+		code := closed.Code
+		if code.Empty() || code == ws.StatusNoStatusRcvd {
+			code = StatusNormal
+		}
+		c.closeWith(code, "", CloseError{Code: closed.Code, Reason: closed.Reason, Remote: true}, false)
+	case errors.Is(err, ErrMessageTooBig), errors.Is(err, wsutil.ErrFrameTooLarge):
+		c.closeWith(StatusMessageTooBig, err.Error(), err, false)
+	case errors.As(err, &protocolErr):
+		c.closeWith(ws.StatusProtocolError, protocolErr.Error(), err, false)
+	case errors.Is(err, wsutil.ErrInvalidUTF8):
+		c.closeWith(ws.StatusInvalidFramePayloadData, err.Error(), err, false)
+	default:
+		c.closeWith(StatusGoingAway, "", err, false)
+	}
+}
+
+// gorutine for reading messages from connection. It is the only sender to
+// In chanel and closes it when reading stops.
 func (c *Conn) GoRead() {
 	go func() {
+		defer close(c.In)
 		for {
 			if !c.isRunning() {
 				return
 			}
-			msg, _, err := wsutil.ReadClientData(c.c)
+			msg, err := c.read()
 			if err != nil {
-				c.Close()
-				break
+				c.closeOnError(err)
+				return
+			}
+			if c.config.OnMessage != nil {
+				c.config.OnMessage(c, true, msg)
+			}
+			select {
+			case c.In <- msg:
+			case <-c.Exit:
+				return
 			}
-			c.In <- msg
 		}
 	}()
 }
 
-// writes data to the connection
+// Queues data to be written to the connection. Returns ErrQueueFull
+// if the write queue is full and ErrClosed if connection is closed.
 func (c *Conn) Send(msg []byte) error {
 	if !c.isRunning() {
-		return errors.New("cant send data to connection: connection is not running anymore")
+		return ErrClosed
+	}
+	select {
+	case c.out <- frame{op: ws.OpText, payload: msg}:
+		if c.config.OnMessage != nil {
+			c.config.OnMessage(c, false, msg)
+		}
+		return nil
+	case <-c.Exit:
+		return ErrClosed
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Queues control frame. Control frame is dropped if its queue is full.
+func (c *Conn) sendControl(f frame) {
+	select {
+	case c.control <- f:
+	default:
 	}
-	err := wsutil.WriteServerMessage(c.c, ws.OpText, msg)
+}
+
+// gorutine for writing queued frames. Control frames are prioritised.
+// When connection is closed queued messages (unless dropped), remaining
+// control frames and close frame are flushed, net.Conn is closed and
+// disconnect hooks are called.
+func (c *Conn) goWrite() {
+	go func() {
+		defer c.finish()
+		for {
+			select {
+			case f := <-c.control:
+				if err := c.write(f); err != nil {
+					c.closeOnError(err)
+				}
+				continue
+			default:
+			}
+			select {
+			case f := <-c.control:
+				if err := c.write(f); err != nil {
+					c.closeOnError(err)
+				}
+			case f := <-c.out:
+				if err := c.write(f); err != nil {
+					c.closeOnError(err)
+				}
+			case <-c.Exit:
+				if c.flushOnClose && !c.flush() {
+					return
+				}
+				for {
+					select {
+					case f := <-c.control:
+						if c.write(f) != nil {
+							return
+						}
+					default:
+						c.write(c.closeFrame)
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Writes messages queued before close. All of them must be written within
+// WriteTimeout. Returns false when writing failed.
+func (c *Conn) flush() bool {
+	if c.config.WriteTimeout > 0 {
+		c.c.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	}
+	for {
+		select {
+		case f := <-c.out:
+			if wsutil.WriteMessage(c.c, c.state, f.op, f.payload) != nil {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// Closes net.Conn and Done chanel and runs disconnect hooks
+func (c *Conn) finish() {
+	c.c.Close()
+	c.errLock.Lock()
+	close(c.done)
+	hooks := c.hooks
+	c.hooks = nil
+	c.errLock.Unlock()
+	for _, fn := range hooks {
+		fn(c, c.Err())
+	}
+}
+
+// Writes single frame to the connection using write deadline
+func (c *Conn) write(f frame) error {
+	if c.config.WriteTimeout > 0 {
+		c.c.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	}
+	return wsutil.WriteMessage(c.c, c.state, f.op, f.payload)
+}
+
+// Reads next data message from the connection. Control frames are handled
+// here and responses to them are queued to the writer.
+func (c *Conn) read() ([]byte, error) {
+	maxFrameSize := c.config.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = c.config.MaxMessageSize
+	}
+	rd := wsutil.Reader{
+		Source:         c.c,
+		State:          c.state,
+		CheckUTF8:      true,
+		MaxFrameSize:   maxFrameSize,
+		OnIntermediate: c.handleControl,
+	}
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+		if hdr.OpCode.IsControl() {
+			if err := c.handleControl(hdr, &rd); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if hdr.OpCode&(ws.OpText|ws.OpBinary) == 0 {
+			if err := rd.Discard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var src io.Reader = &rd
+		if max := c.config.MaxMessageSize; max > 0 {
+			src = io.LimitReader(src, max+1)
+		}
+		msg, err := ioutil.ReadAll(src)
+		if err == nil && c.config.MaxMessageSize > 0 && int64(len(msg)) > c.config.MaxMessageSize {
+			err = ErrMessageTooBig
+		}
+		if err == nil {
+			atomic.StoreInt64(&c.lastMessage, time.Now().UnixNano())
+		}
+		return msg, err
+	}
+}
+
+// Handles control frame received from the other side
+func (c *Conn) handleControl(hdr ws.Header, r io.Reader) error {
+	payload, err := ioutil.ReadAll(r)
 	if err != nil {
-		c.Close()
+		return err
+	}
+	switch hdr.OpCode {
+	case ws.OpPing:
+		c.sendControl(frame{op: ws.OpPong, payload: payload})
+	case ws.OpPong:
+		atomic.StoreInt64(&c.lastPong, time.Now().UnixNano())
+	case ws.OpClose:
+		code, reason := ws.ParseCloseFrameData(payload)
+		return wsutil.ClosedError{Code: code, Reason: reason}
 	}
-	return err
+	return nil
 }
 
 // Checks if connection is still running by reading from conn.Exit chanel.
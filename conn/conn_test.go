@@ -0,0 +1,71 @@
+package conn
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCloseFlushesQueuedMessages(t *testing.T) {
+	server, client := net.Pipe()
+	sc := NewConn(server)
+	cc := NewClientConn(client, DefaultConfig())
+	defer cc.Close()
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		if err := sc.Send([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sc.Close()
+
+	for i := 0; i < count; i++ {
+		select {
+		case msg, ok := <-cc.In:
+			if !ok {
+				t.Fatalf("connection closed after %d of %d messages", i, count)
+			}
+			if string(msg) != fmt.Sprint(i) {
+				t.Fatalf("message %d: got %s", i, msg)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("message %d was not received", i)
+		}
+	}
+	select {
+	case <-cc.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("close frame was not received")
+	}
+	if err, ok := cc.Err().(CloseError); !ok || !err.Remote || err.Code != StatusNormal {
+		t.Fatalf("unexpected close cause %v", cc.Err())
+	}
+}
+
+func TestCloseGivesUpFlushingAfterWriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	config := DefaultConfig()
+	config.WriteTimeout = time.Millisecond * 50
+	sc := NewConnConfig(server, config)
+
+	for i := 0; i < 10; i++ {
+		if err := sc.Send([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Nothing reads from the client side
+	for _, closeFn := range []func(){sc.Close, func() { sc.CloseNow(StatusGoingAway, "") }} {
+		closeFn()
+		select {
+		case <-sc.Done():
+		case <-time.After(time.Second * 5):
+			t.Fatal("connection was not closed after write timeout")
+		}
+	}
+	if err := sc.Send([]byte("late")); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
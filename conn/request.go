@@ -0,0 +1,135 @@
+package conn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kroksys/jrpc/spec"
+)
+
+const DefaultRequestTimeout = time.Second * 30
+
+var ErrRequestTimeout = errors.New("request timed out waiting for response")
+
+// Sends request to the client and waits for its response. Waits until
+// context is done, RequestTimeout passes (when context has no deadline) or
+// connection is closed. Error returned by the client is in Response.Error.
+/*
+	// Inside of a service method
+	func (s Service) Delete(ctx context.Context, id string) error {
+		c, _ := registry.ConnFromContext(ctx)
+		resp, err := c.Request(ctx, "confirm", []interface{}{"delete " + id})
+		...
+	}
+*/
+func (c *Conn) Request(ctx context.Context, method string, params interface{}) (spec.Response, error) {
+	if !c.isRunning() {
+		return spec.Response{}, ErrClosed
+	}
+	if _, ok := ctx.Deadline(); !ok && c.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+	request := spec.NewRequest()
+	request.Method = method
+	request.Params = params
+	request.ID = atomic.AddUint64(&c.lastRequestID, 1)
+	data, err := c.config.Codec.Marshal(request)
+	if err != nil {
+		return spec.Response{}, err
+	}
+
+	key := requestKey(request.ID)
+	wait := make(chan spec.Response, 1)
+	c.pending.Put(key, wait)
+	defer c.pending.Delete(key)
+	if err := c.Send(data); err != nil {
+		return spec.Response{}, err
+	}
+
+	select {
+	case resp := <-wait:
+		return resp, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return spec.Response{}, ErrRequestTimeout
+		}
+		return spec.Response{}, ctx.Err()
+	case <-c.Exit:
+		return spec.Response{}, ErrClosed
+	}
+}
+
+// Sends requests as one batch and waits for all responses. Requests get
+// new IDs. Responses are returned in the order of requests.
+func (c *Conn) RequestBatch(ctx context.Context, batch spec.BatchRequest) ([]spec.Response, error) {
+	if !c.isRunning() {
+		return nil, ErrClosed
+	}
+	if _, ok := ctx.Deadline(); !ok && c.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+	waits := make([]chan spec.Response, len(batch))
+	for i := range batch {
+		batch[i].Jsonrpc = spec.JsonRpcVersion
+		batch[i].ID = atomic.AddUint64(&c.lastRequestID, 1)
+		key := requestKey(batch[i].ID)
+		waits[i] = make(chan spec.Response, 1)
+		c.pending.Put(key, waits[i])
+		defer c.pending.Delete(key)
+	}
+	data, err := c.config.Codec.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Send(data); err != nil {
+		return nil, err
+	}
+
+	responses := make([]spec.Response, len(batch))
+	for i, wait := range waits {
+		select {
+		case responses[i] = <-wait:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrRequestTimeout
+			}
+			return nil, ctx.Err()
+		case <-c.Exit:
+			return nil, ErrClosed
+		}
+	}
+	return responses, nil
+}
+
+// Passes response received from the client to the waiting Request.
+// Returns false when no request is waiting for it.
+func (c *Conn) Resolve(resp spec.Response) bool {
+	if resp.ID == nil {
+		return false
+	}
+	key := requestKey(resp.ID)
+	wait, ok := c.pending.GetOk(key)
+	if !ok {
+		return false
+	}
+	c.pending.Delete(key)
+	select {
+	case wait <- resp:
+		return true
+	default:
+		return false
+	}
+}
+
+// Key of pending request. IDs are sent as numbers and decoded as float64,
+// so both are formatted the same way.
+func requestKey(id interface{}) string {
+	return fmt.Sprint(id)
+}
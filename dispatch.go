@@ -0,0 +1,242 @@
+package jrpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Number of queued calls in sequential mode when MaxInFlight is not set
+const defaultSequentialQueue = 64
+
+// Per connection execution state used to limit concurrency
+type execState struct {
+	// Call slots, one in sequential mode. Nil when calls are not limited.
+	slots chan struct{}
+
+	// Calls waiting for a free slot in arrival order. Nil when calls are
+	// not limited or rejected instead of waiting.
+	queue chan func()
+}
+
+// Creates execution state for the connection. When calls wait for a free
+// slot starts gorutine executing queued calls in arrival order until
+// connection is closed. Calls are queued instead of blocking the reader, so
+// responses to conn.Request are read while calls wait.
+func (s *Server) newExecState(c *conn.Conn) *execState {
+	st := &execState{}
+	switch {
+	case s.Sequential:
+		st.slots = make(chan struct{}, 1)
+	case s.MaxInFlight > 0:
+		st.slots = make(chan struct{}, s.MaxInFlight)
+	default:
+		return st
+	}
+	if s.RejectWhenBusy && !s.Sequential {
+		return st
+	}
+	size := s.MaxInFlight
+	if size <= 0 {
+		size = defaultSequentialQueue
+	}
+	st.queue = make(chan func(), size)
+	go func() {
+		for {
+			select {
+			case job := <-st.queue:
+				select {
+				case st.slots <- struct{}{}:
+					go st.run(job)
+				case <-c.Exit:
+					return
+				}
+			case <-c.Exit:
+				return
+			}
+		}
+	}()
+	return st
+}
+
+// Executes job and frees its slot
+func (st *execState) run(job func()) {
+	defer func() { <-st.slots }()
+	job()
+}
+
+// Parses incoming message and schedules its execution. Returns false when
+// connection was closed while waiting for a place in the queue.
+func (s *Server) dispatch(ctx context.Context, c *conn.Conn, msg []byte, st *execState) bool {
+	if err := spec.CheckLimits(msg, s.Limits); err != nil {
+		s.logf("Conn:%s invalid request: %s\n", c.ID, err.Error())
+		s.send(c, spec.NewResponseError(nil, *spec.NewError(spec.InvalidRequestCode, err.Error())))
+		return true
+	}
+	data, tp := spec.ParseCodec(s.Codec, msg)
+	switch tp {
+	case spec.TypeRequest:
+		request := data.(spec.Request)
+		if s.Registry.IsSubscriptionRequest(request) {
+			// Subscriptions block while running. They are limited to one per
+			// method on a connection, so they are not counted as in-flight.
+			go func() {
+				s.send(c, s.call(ctx, request, c))
+			}()
+			return true
+		}
+		return s.schedule(c, st, func() {
+			s.send(c, s.call(ctx, request, c))
+		}, func() {
+			s.send(c, busyResponse(request))
+		})
+	case spec.TypeBatchRequest:
+		batch := data.(spec.BatchRequest)
+		return s.schedule(c, st, func() {
+			s.callBatch(ctx, batch, c)
+		}, func() {
+			result := spec.BatchResponse{}
+			for _, request := range batch {
+				if !request.IsNotification() {
+					result = append(result, busyResponse(request))
+				}
+			}
+			if len(result) > 0 {
+				s.send(c, result)
+			}
+		})
+	case spec.TypeNotification:
+		notification := data.(spec.Notification)
+		if s.Registry.IsSubscriptionRequest(notificationRequest(notification)) {
+			go s.notify(ctx, notification, c)
+			return true
+		}
+		// Notifications routed to methods are limited the same way as calls,
+		// they are not answered, so rejected ones are only logged
+		return s.schedule(c, st, func() {
+			s.notify(ctx, notification, c)
+		}, func() {
+			s.logf("Conn:%s notification %s rejected: too many calls in flight\n", c.ID, notification.Method)
+		})
+	case spec.TypeResponse:
+		s.resolve(c, data.(spec.Response))
+	case spec.TypeBatchResponse:
+		for _, resp := range data.(spec.BatchResponse) {
+			s.resolve(c, resp)
+		}
+	}
+	return true
+}
+
+// Executes job according to concurrency settings. Calls reject when
+// connection is busy and RejectWhenBusy is set. Blocks only while the queue
+// of waiting calls is full. Returns false when connection was closed while
+// waiting.
+func (s *Server) schedule(c *conn.Conn, st *execState, job func(), reject func()) bool {
+	switch {
+	case st.queue != nil && s.RejectWhenBusy:
+		select {
+		case st.queue <- job:
+		default:
+			reject()
+		}
+	case st.queue != nil:
+		select {
+		case st.queue <- job:
+		case <-c.Exit:
+			return false
+		}
+	case st.slots != nil:
+		select {
+		case st.slots <- struct{}{}:
+			go st.run(job)
+		default:
+			reject()
+		}
+	default:
+		go job()
+	}
+	return true
+}
+
+// Executes single request using registry
+func (s *Server) call(ctx context.Context, request spec.Request, c *conn.Conn) spec.Response {
+	s.logf("Request Id:%v Method:%s Params: %v\n", request.ID, request.Method, request.Params)
+	release := s.acquire(request)
+	resp := s.Registry.Call(ctx, request, c)
+	release()
+	s.logf("Response Id:%v Result:%v Err: %v\n", resp.ID, resp.Result, resp.Error)
+	return resp
+}
+
+// Executes batch requests concurrently and sends responses as one array.
+// Notifications inside batch are not answered. Subscriptions run until
+// unsubscribed, so they are rejected instead of holding the whole batch.
+func (s *Server) callBatch(ctx context.Context, batch spec.BatchRequest, c *conn.Conn) {
+	responses := make(spec.BatchResponse, len(batch))
+	wg := sync.WaitGroup{}
+	for i := range batch {
+		if s.Registry.IsSubscriptionRequest(batch[i]) {
+			responses[i] = spec.NewResponseError(batch[i].ID,
+				*spec.NewError(spec.InvalidRequestCode, "subscriptions are not allowed in batch"))
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = s.call(ctx, batch[i], c)
+		}(i)
+	}
+	wg.Wait()
+	result := spec.BatchResponse{}
+	for i, resp := range responses {
+		if !batch[i].IsNotification() {
+			result = append(result, resp)
+		}
+	}
+	if len(result) > 0 {
+		s.send(c, result)
+	}
+}
+
+// Executes notification (subscribe, unsubscribe or method call) using
+// registry
+func (s *Server) notify(ctx context.Context, notification spec.Notification, c *conn.Conn) {
+	s.logf("Method:%s Params: %v\n", notification.Method, notification.Params)
+	release := s.acquire(notificationRequest(notification))
+	err := s.Registry.Subscribe(ctx, notification, c)
+	release()
+	if err != nil {
+		s.logf("%s:error: %v\n", notification.Method, err)
+		s.send(c, err)
+	}
+}
+
+// Passes response from the client to request sent with conn.Request
+func (s *Server) resolve(c *conn.Conn, resp spec.Response) {
+	if !c.Resolve(resp) {
+		s.logf("Conn:%s unexpected response Id:%v\n", c.ID, resp.ID)
+	}
+}
+
+// Encodes message using server codec and sends it to the connection
+func (s *Server) send(c *conn.Conn, msg interface{}) {
+	data, err := s.Codec.Marshal(msg)
+	if err != nil {
+		s.logf("Conn:%s codec.Marshal error: %s\n", c.ID, err.Error())
+		return
+	}
+	c.Send(data)
+}
+
+// Request without ID with method and params of the notification
+func notificationRequest(notification spec.Notification) spec.Request {
+	return spec.Request{Jsonrpc: notification.Jsonrpc, Method: notification.Method, Params: notification.Params}
+}
+
+// Response for a request rejected because connection is busy
+func busyResponse(request spec.Request) spec.Response {
+	return spec.NewResponseError(request.ID, *spec.NewError(spec.ServerBusyCode, "too many calls in flight"))
+}
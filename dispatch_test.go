@@ -0,0 +1,283 @@
+package jrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/jrpctest"
+	"github.com/kroksys/jrpc/registry"
+	"github.com/kroksys/jrpc/spec"
+)
+
+type Math struct{}
+
+func (Math) Add(x, y int) int {
+	return x + y
+}
+
+// Sends counter values until unsubscribed
+func (Math) Counter(sub *registry.Subscription) error {
+	for i := 1; sub.IsRunning(); i++ {
+		if err := sub.Notify(i); err != nil {
+			return err
+		}
+		select {
+		case <-sub.Exit:
+		case <-sub.Conn.Exit:
+		}
+	}
+	return nil
+}
+
+// Starts harness with Math service registered as "math"
+func newMathHarness(t *testing.T, opts ...jrpc.Option) *jrpctest.Harness {
+	t.Helper()
+	s, err := jrpc.NewServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("math", Math{}); err != nil {
+		t.Fatal(err)
+	}
+	return jrpctest.New(t, s)
+}
+
+// Decodes batch response and returns responses by id
+func decodeBatch(t *testing.T, data []byte) map[float64]spec.Response {
+	t.Helper()
+	var batch []spec.Response
+	if err := json.Unmarshal(data, &batch); err != nil {
+		t.Fatalf("invalid batch response %s: %s", data, err)
+	}
+	responses := map[float64]spec.Response{}
+	for _, resp := range batch {
+		id, _ := resp.ID.(float64)
+		responses[id] = resp
+	}
+	return responses
+}
+
+func TestBatchRejectsSubscriptions(t *testing.T) {
+	h := newMathHarness(t)
+	raw := h.Raw(t)
+
+	responses := decodeBatch(t, raw.Roundtrip(`[
+		{"jsonrpc":"2.0","id":1,"method":"math.Add","params":[1,2]},
+		{"jsonrpc":"2.0","id":2,"method":"math.subscribe.Counter"},
+		{"jsonrpc":"2.0","id":3,"method":"math.unsubscribe.Counter"}
+	]`))
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %v", responses)
+	}
+	if resp := responses[1]; resp.Error != nil || resp.Result != float64(3) {
+		t.Fatalf("math.Add: unexpected response %+v", resp)
+	}
+	for _, id := range []float64{2, 3} {
+		if resp := responses[id]; resp.Error == nil || resp.Error.Code != spec.InvalidRequestCode {
+			t.Fatalf("request %v: expected invalid request error, got %+v", id, resp)
+		}
+	}
+}
+
+// Calls of Gate block until released. Keeps number of calls running at the
+// same time.
+type Gate struct {
+	started chan int
+	release chan struct{}
+	running int32
+	max     int32
+}
+
+func newGate() *Gate {
+	return &Gate{started: make(chan int, 16), release: make(chan struct{})}
+}
+
+func (g *Gate) Pass(id int) int {
+	running := atomic.AddInt32(&g.running, 1)
+	defer atomic.AddInt32(&g.running, -1)
+	for {
+		max := atomic.LoadInt32(&g.max)
+		if running <= max || atomic.CompareAndSwapInt32(&g.max, max, running) {
+			break
+		}
+	}
+	g.started <- id
+	<-g.release
+	return id
+}
+
+// Waits for the next call to start and returns its id
+func (g *Gate) next(t *testing.T) int {
+	t.Helper()
+	select {
+	case id := <-g.started:
+		return id
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("call did not start")
+	}
+	return 0
+}
+
+// Checks that no other call starts for a while
+func (g *Gate) expectWaiting(t *testing.T) {
+	t.Helper()
+	select {
+	case id := <-g.started:
+		t.Fatalf("call %d started over the limit", id)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+// Starts harness with Gate service registered as "gate"
+func newGateHarness(t *testing.T, opts ...jrpc.Option) (*jrpctest.Harness, *Gate) {
+	t.Helper()
+	s, err := jrpc.NewServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := newGate()
+	if err := s.Register("gate", gate); err != nil {
+		t.Fatal(err)
+	}
+	return jrpctest.New(t, s), gate
+}
+
+func TestMaxInFlightWaitsForFreeSlot(t *testing.T) {
+	h, gate := newGateHarness(t, jrpc.WithMaxInFlight(2))
+	results := make(chan *jrpctest.Response, 4)
+	for i := 1; i <= 4; i++ {
+		go func(i int) { results <- h.Call(t, "gate.Pass", []int{i}) }(i)
+	}
+	gate.next(t)
+	gate.next(t)
+	gate.expectWaiting(t)
+
+	gate.release <- struct{}{}
+	<-results
+	gate.next(t)
+	gate.expectWaiting(t)
+	close(gate.release)
+	gate.next(t)
+	for i := 0; i < 3; i++ {
+		(<-results).ExpectOK()
+	}
+	if max := atomic.LoadInt32(&gate.max); max != 2 {
+		t.Fatalf("%d calls were running at the same time", max)
+	}
+}
+
+func TestRejectWhenBusy(t *testing.T) {
+	h, gate := newGateHarness(t, jrpc.WithMaxInFlight(1), jrpc.WithRejectWhenBusy(true))
+	first := make(chan *jrpctest.Response, 1)
+	go func() { first <- h.Call(t, "gate.Pass", []int{1}) }()
+	gate.next(t)
+
+	h.Call(t, "gate.Pass", []int{2}).ExpectError(spec.ServerBusyCode)
+	close(gate.release)
+	(<-first).Expect(1)
+	h.Call(t, "gate.Pass", []int{3}).Expect(3)
+}
+
+func TestSequentialKeepsOrder(t *testing.T) {
+	h, gate := newGateHarness(t, jrpc.WithSequential(true))
+	raw := h.Raw(t)
+	for i := 1; i <= 5; i++ {
+		raw.Send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"gate.Pass","params":[%d]}`, i, i))
+	}
+	for i := 1; i <= 5; i++ {
+		if id := gate.next(t); id != i {
+			t.Fatalf("call %d started, expected %d", id, i)
+		}
+		gate.expectWaiting(t)
+		gate.release <- struct{}{}
+		expected := fmt.Sprintf(`{"jsonrpc":"2.0","result":%d,"id":%d}`, i, i)
+		if msg := string(raw.Receive()); msg != expected {
+			t.Fatalf("got %s, expected %s", msg, expected)
+		}
+	}
+}
+
+// Asks the client to confirm with conn.Request
+type Asker struct{}
+
+func (Asker) Ask(ctx context.Context, question string) (bool, error) {
+	c, ok := registry.ConnFromContext(ctx)
+	if !ok {
+		return false, errors.New("missing connection")
+	}
+	resp, err := c.Request(ctx, "ui.Confirm", []interface{}{question})
+	if err != nil {
+		return false, err
+	}
+	if resp.Error != nil {
+		return false, errors.New(string(resp.Error.Message))
+	}
+	return resp.Result == true, nil
+}
+
+// Reads ui.Confirm request sent by the server and returns its id
+func receiveConfirm(t *testing.T, raw *jrpctest.RawConn) interface{} {
+	t.Helper()
+	msg := raw.Receive()
+	var req spec.Request
+	if err := json.Unmarshal(msg, &req); err != nil || req.Method != "ui.Confirm" {
+		t.Fatalf("expected ui.Confirm request, got %s", msg)
+	}
+	return req.ID
+}
+
+func TestWaitingCallsDoNotBlockResponses(t *testing.T) {
+	for _, opt := range []jrpc.Option{jrpc.WithMaxInFlight(1), jrpc.WithSequential(true)} {
+		s, err := jrpc.NewServer(opt, jrpc.WithRequestTimeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Register("asker", Asker{}); err != nil {
+			t.Fatal(err)
+		}
+		raw := jrpctest.New(t, s).Raw(t)
+
+		raw.Send(`{"jsonrpc":"2.0","id":1,"method":"asker.Ask","params":["first"]}`)
+		id := receiveConfirm(t, raw)
+		// Second call waits for the first one while its request is answered
+		raw.Send(`{"jsonrpc":"2.0","id":2,"method":"asker.Ask","params":["second"]}`)
+		raw.Send(fmt.Sprintf(`{"jsonrpc":"2.0","result":true,"id":%v}`, id))
+		if msg := string(raw.Receive()); msg != `{"jsonrpc":"2.0","result":true,"id":1}` {
+			t.Fatalf("unexpected response %s", msg)
+		}
+		id = receiveConfirm(t, raw)
+		raw.Send(fmt.Sprintf(`{"jsonrpc":"2.0","result":false,"id":%v}`, id))
+		if msg := string(raw.Receive()); msg != `{"jsonrpc":"2.0","result":false,"id":2}` {
+			t.Fatalf("unexpected response %s", msg)
+		}
+	}
+}
+
+func TestNotificationsAreLimitedLikeCalls(t *testing.T) {
+	for _, opt := range []jrpc.Option{
+		jrpc.WithMaxInFlight(1),
+		jrpc.WithSequential(true),
+		jrpc.WithMaxConcurrentCalls(1),
+	} {
+		h, gate := newGateHarness(t, opt)
+		raw := h.Raw(t)
+		for i := 1; i <= 5; i++ {
+			raw.Send(fmt.Sprintf(`{"jsonrpc":"2.0","method":"gate.Pass","params":[%d]}`, i))
+		}
+		gate.next(t)
+		gate.expectWaiting(t)
+		close(gate.release)
+		for i := 0; i < 4; i++ {
+			gate.next(t)
+		}
+		if max := atomic.LoadInt32(&gate.max); max != 1 {
+			t.Fatalf("%d notifications were running at the same time", max)
+		}
+	}
+}
@@ -2,23 +2,43 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/registry"
 )
 
 func main() {
 	host := "localhost:3333"
 	gin.SetMode(gin.ReleaseMode)
-	jrpcServer := jrpc.NewServer(true)
-	if err := jrpcServer.Register("example", Example{}); err != nil {
+	jrpcServer, err := jrpc.NewServer(jrpc.WithLogs(true))
+	if err != nil {
+		log.Panicln(err)
+	}
+	// Payload declares type of subscription messages for generated clients:
+	// go run ./cmd/jrpcgen -url ws://localhost:3333/ws -pkg exampleclient
+	if err := jrpcServer.Register("example", Example{},
+		registry.Payload("Subscription", ""),
+		registry.Payload("SubscriptionWithContext", ""),
+	); err != nil {
+		log.Panicln(err)
+	}
+
+	// {"jsonrpc":"2.0","method":"example.subscribe.time", "id": 1}
+	if err := jrpcServer.RegisterTopic("example.time", nil); err != nil {
 		log.Panicln(err)
 	}
+	go func() {
+		for t := range time.Tick(time.Second) {
+			jrpcServer.Publish("example.time", t.Format(time.RFC3339))
+		}
+	}()
 
 	r := gin.Default()
 	r.GET("/ws", jrpcServer.WebsocketHandlerGin)
 	log.Printf("JSON RPC 2.0 server started. Address: %s/ws\n", host)
-	err := r.Run(host)
+	err = r.Run(host)
 	if err != nil {
 		log.Println("jrpc server stopped")
 	}
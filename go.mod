@@ -8,6 +8,7 @@ require (
 	github.com/google/uuid v1.3.0
 	github.com/kroksys/pool v0.0.7
 	github.com/mitchellh/mapstructure v1.5.0
+	golang.org/x/sys v0.0.0-20210510120138-977fb7262007
 )
 
 require (
@@ -27,7 +28,6 @@ require (
 	github.com/stretchr/testify v1.7.0 // indirect
 	github.com/ugorji/go/codec v1.1.7 // indirect
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
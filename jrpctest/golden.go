@@ -0,0 +1,55 @@
+package jrpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Golden files are written instead of compared when tests run with
+// -jrpctest.update
+var update = flag.Bool("jrpctest.update", false, "update jrpctest golden files")
+
+// Compares json with golden file. Both are indented before comparing, so
+// formatting does not matter. File is written when tests run with
+// -jrpctest.update.
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	got, err := indentJSON(got)
+	if err != nil {
+		t.Fatalf("jrpctest: golden %s: invalid json %s: %s", path, got, err)
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("jrpctest: golden %s: %s", path, err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("jrpctest: golden %s: %s", path, err)
+		}
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("jrpctest: golden %s: %s (run with -jrpctest.update to create it)", path, err)
+	}
+	want, err := indentJSON(data)
+	if err != nil {
+		t.Fatalf("jrpctest: golden %s: invalid json: %s", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("jrpctest: golden %s differs\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// Returns indented json ending with new line
+func indentJSON(data []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, bytes.TrimSpace(data), "", "  "); err != nil {
+		return data, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+// Package jrpctest runs a jrpc Server and a client in the same process so
+// service methods can be tested end-to-end without gin or a TCP listener.
+/*
+	func TestAdd(t *testing.T) {
+		s, _ := jrpc.NewServer()
+		s.Register("math", Math{})
+		h := jrpctest.New(t, s)
+
+		h.Call(t, "math.Add", []int{1, 2}).Expect(3)
+		h.Call(t, "math.Div", []int{1, 0}).ExpectError(spec.InternalErrorCode)
+
+		sub := h.Subscribe(t, "math.subscribe.Counter", nil)
+		sub.Expect(1).Expect(2)
+		sub.Unsubscribe()
+	}
+*/
+package jrpctest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Time to wait for responses and subscription messages
+const DefaultTimeout = time.Second * 5
+
+// Harness connects a client to the server. Connections are closed when
+// the test ends.
+type Harness struct {
+	Server *jrpc.Server
+
+	// Client connected to the server
+	Client *client.Client
+
+	// Time to wait for responses and subscription messages
+	Timeout time.Duration
+
+	// Websocket url of the server when started with NewHTTP
+	URL string
+
+	// Opens new websocket connection to the server
+	dial func(t testing.TB) net.Conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Connects client to the server using net.Pipe. Options configure the
+// client, i.e. client.WithRegistry to serve requests sent by the server.
+func New(t testing.TB, s *jrpc.Server, opts ...client.Option) *Harness {
+	t.Helper()
+	h := newHarness(t, s)
+	h.dial = h.pipe
+	h.Client = h.NewClient(t, opts...)
+	return h
+}
+
+// Starts the server on httptest server and connects client to it. Unlike
+// New it runs the upgrade, so origin checks, subprotocols and principal
+// are tested as well. Header and subprotocols are set with client options.
+func NewHTTP(t testing.TB, s *jrpc.Server, opts ...client.Option) *Harness {
+	t.Helper()
+	h := newHarness(t, s)
+	srv := httptest.NewServer(http.HandlerFunc(s.WebsocketHandler))
+	t.Cleanup(srv.Close)
+	h.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	h.dial = h.websocket
+	c, err := client.Dial(context.Background(), h.URL, opts...)
+	if err != nil {
+		t.Fatalf("jrpctest: dial %s: %s", h.URL, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	h.Client = c
+	return h
+}
+
+// Creates harness closing its connections on test cleanup
+func newHarness(t testing.TB, s *jrpc.Server) *Harness {
+	h := &Harness{
+		Server:  s,
+		Timeout: DefaultTimeout,
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		h.cancel()
+		h.wg.Wait()
+	})
+	return h
+}
+
+// Connects another client to the server, i.e. to test messages sent to
+// multiple connections. Client is closed when the test ends.
+func (h *Harness) NewClient(t testing.TB, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(h.dial(t), opts...)
+	if err != nil {
+		t.Fatalf("jrpctest: new client: %s", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// Calls method and returns response for assertions. Fails the test when
+// no response arrives in time.
+func (h *Harness) Call(t testing.TB, method string, params interface{}) *Response {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	r := &Response{t: t, Method: method}
+	err := h.Client.Call(ctx, method, params, &r.Result)
+	if err != nil && !errors.As(err, &r.Error) {
+		t.Fatalf("jrpctest: call %s: %s", method, err)
+	}
+	return r
+}
+
+// Sends notification. Fails the test when it can not be sent.
+func (h *Harness) Notify(t testing.TB, method string, params interface{}) {
+	t.Helper()
+	if err := h.Client.Notify(context.Background(), method, params); err != nil {
+		t.Fatalf("jrpctest: notify %s: %s", method, err)
+	}
+}
+
+// Subscribes to subscription or topic and returns it for assertions.
+// Subscription is unsubscribed when the test ends.
+func (h *Harness) Subscribe(t testing.TB, method string, params interface{}) *Subscription {
+	t.Helper()
+	sub, err := h.Client.Subscribe(context.Background(), method, params)
+	if err != nil {
+		t.Fatalf("jrpctest: subscribe %s: %s", method, err)
+	}
+	t.Cleanup(func() {
+		select {
+		case <-sub.Done():
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+			defer cancel()
+			sub.Unsubscribe(ctx)
+		}
+	})
+	return &Subscription{Sub: sub, Method: method, t: t, timeout: h.Timeout}
+}
+
+// Opens connection served by the server through net.Pipe
+func (h *Harness) pipe(t testing.TB) net.Conn {
+	server, client := net.Pipe()
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.Server.ServeConn(h.ctx, server)
+	}()
+	return client
+}
+
+// Opens websocket connection to httptest server
+func (h *Harness) websocket(t testing.TB) net.Conn {
+	t.Helper()
+	cn, br, _, err := ws.Dial(context.Background(), h.URL)
+	if err != nil {
+		t.Fatalf("jrpctest: dial %s: %s", h.URL, err)
+	}
+	return conn.Buffered(cn, br)
+}
+
+// Checks if err is a response error with code
+func hasCode(err *client.Error, code spec.ErrorCode) bool {
+	return err != nil && err.Code == code
+}
@@ -0,0 +1,90 @@
+package jrpctest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/recorder"
+)
+
+// Connection sending and receiving raw frames, i.e. to test malformed
+// requests, batches or exact responses with golden files.
+type RawConn struct {
+	Conn *conn.Conn
+
+	t       testing.TB
+	timeout time.Duration
+}
+
+// Opens connection to the server sending raw frames. Connection is closed
+// when the test ends.
+/*
+	raw := h.Raw(t)
+	resp := raw.Roundtrip(`[{"jsonrpc":"2.0","method":"math.Add","params":[1,2],"id":1}]`)
+	jrpctest.Golden(t, "testdata/add_batch.json", resp)
+*/
+func (h *Harness) Raw(t testing.TB) *RawConn {
+	t.Helper()
+	c := conn.NewClientConn(h.dial(t), conn.DefaultConfig())
+	t.Cleanup(func() {
+		c.Close()
+		<-c.Done()
+	})
+	return &RawConn{Conn: c, t: t, timeout: h.Timeout}
+}
+
+// Sends raw frame
+func (r *RawConn) Send(msg string) {
+	r.t.Helper()
+	if err := r.Conn.Send([]byte(msg)); err != nil {
+		r.t.Fatalf("jrpctest: send: %s", err)
+	}
+}
+
+// Waits for the next frame from the server
+func (r *RawConn) Receive() []byte {
+	r.t.Helper()
+	select {
+	case msg, ok := <-r.Conn.In:
+		if !ok {
+			r.t.Fatalf("jrpctest: connection closed waiting for message: %v", r.Conn.Err())
+		}
+		return msg
+	case <-time.After(r.timeout):
+		r.t.Fatalf("jrpctest: no message in %s", r.timeout)
+	}
+	return nil
+}
+
+// Sends raw frame and waits for the next frame from the server
+func (r *RawConn) Roundtrip(msg string) []byte {
+	r.t.Helper()
+	r.Send(msg)
+	return r.Receive()
+}
+
+// Replays recording made with jrpc.WithRecorder against the server and
+// fails the test when responses differ from the recorded ones
+/*
+	h.Replay(t, "testdata/traffic.jsonl", recorder.Ignore("time"))
+*/
+func (h *Harness) Replay(t testing.TB, path string, opts ...recorder.Option) {
+	t.Helper()
+	entries, err := recorder.ReadFile(path)
+	if err != nil {
+		t.Fatalf("jrpctest: replay: %s", err)
+	}
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return h.dial(t), nil
+	}
+	diffs, err := recorder.Replay(context.Background(), entries, dial, append([]recorder.Option{recorder.WithWait(h.Timeout)}, opts...)...)
+	if err != nil {
+		t.Fatalf("jrpctest: replay %s: %s", path, err)
+	}
+	if len(diffs) > 0 {
+		t.Fatalf("jrpctest: replay %s: %d differences\n%s", path, len(diffs), recorder.Format(diffs))
+	}
+}
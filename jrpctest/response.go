@@ -0,0 +1,122 @@
+package jrpctest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Response of a call. Assertions fail the test that made the call.
+type Response struct {
+	Method string
+
+	// Raw json result. Empty when the server returned error.
+	Result json.RawMessage
+
+	// Error returned by the server
+	Error *client.Error
+
+	t testing.TB
+}
+
+// Asserts that call succeeded and its result equals expected when both
+// are encoded as json
+func (r *Response) Expect(expected interface{}) *Response {
+	r.t.Helper()
+	r.ExpectOK()
+	if ok, err := equalJSON(r.Result, expected); err != nil {
+		r.t.Fatalf("jrpctest: %s: %s", r.Method, err)
+	} else if !ok {
+		r.t.Fatalf("jrpctest: %s: result %s, expected %s", r.Method, r.Result, mustJSON(expected))
+	}
+	return r
+}
+
+// Asserts that call succeeded
+func (r *Response) ExpectOK() *Response {
+	r.t.Helper()
+	if r.Error != nil {
+		r.t.Fatalf("jrpctest: %s: unexpected error %s", r.Method, r.Error)
+	}
+	return r
+}
+
+// Asserts that server returned error with code
+func (r *Response) ExpectError(code spec.ErrorCode) *Response {
+	r.t.Helper()
+	if r.Error == nil {
+		r.t.Fatalf("jrpctest: %s: expected error %d, got result %s", r.Method, code, r.Result)
+	}
+	if !hasCode(r.Error, code) {
+		r.t.Fatalf("jrpctest: %s: expected error %d, got %s", r.Method, code, r.Error)
+	}
+	return r
+}
+
+// Asserts that error data equals expected when both are encoded as json
+func (r *Response) ExpectErrorData(expected interface{}) *Response {
+	r.t.Helper()
+	if r.Error == nil {
+		r.t.Fatalf("jrpctest: %s: expected error, got result %s", r.Method, r.Result)
+	}
+	data := mustJSON(r.Error.Data)
+	if ok, err := equalJSON(data, expected); err != nil {
+		r.t.Fatalf("jrpctest: %s: %s", r.Method, err)
+	} else if !ok {
+		r.t.Fatalf("jrpctest: %s: error data %s, expected %s", r.Method, data, mustJSON(expected))
+	}
+	return r
+}
+
+// Decodes result into v. Fails when the server returned error.
+func (r *Response) Decode(v interface{}) *Response {
+	r.t.Helper()
+	r.ExpectOK()
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		r.t.Fatalf("jrpctest: %s: decode result %s: %s", r.Method, r.Result, err)
+	}
+	return r
+}
+
+// Compares response with golden file. Response is written as
+// {"result": ...} or {"error": ...} without id, so it does not depend on
+// calls made before.
+func (r *Response) Golden(path string) *Response {
+	r.t.Helper()
+	body := map[string]interface{}{}
+	if r.Error != nil {
+		body["error"] = spec.Error{Code: r.Error.Code, Message: r.Error.Message, Data: r.Error.Data}
+	} else {
+		body["result"] = r.Result
+	}
+	Golden(r.t, path, mustJSON(body))
+	return r
+}
+
+// Checks if json data equals expected value encoded as json
+func equalJSON(data []byte, expected interface{}) (bool, error) {
+	var got, want interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(mustJSON(expected), &want); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(got, want), nil
+}
+
+// Encodes value as json. Values that can not be encoded are written as
+// json string with the error.
+func mustJSON(v interface{}) []byte {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal("jrpctest: " + err.Error())
+	}
+	return data
+}
@@ -0,0 +1,126 @@
+package jrpctest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc/client"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Subscription with assertions waiting for messages up to the harness
+// timeout. Assertions fail the test that subscribed.
+type Subscription struct {
+	Sub    *client.Subscription
+	Method string
+
+	t       testing.TB
+	timeout time.Duration
+}
+
+// Waits for the next message and returns it as raw json
+func (s *Subscription) Next() json.RawMessage {
+	s.t.Helper()
+	select {
+	case msg, ok := <-s.Sub.C:
+		if !ok {
+			s.t.Fatalf("jrpctest: %s: subscription ended waiting for message: %v", s.Method, s.Sub.Err())
+		}
+		return mustJSON(msg)
+	case <-time.After(s.timeout):
+		s.t.Fatalf("jrpctest: %s: no message in %s", s.Method, s.timeout)
+	}
+	return nil
+}
+
+// Asserts that the next message equals expected when both are encoded
+// as json
+func (s *Subscription) Expect(expected interface{}) *Subscription {
+	s.t.Helper()
+	msg := s.Next()
+	if ok, err := equalJSON(msg, expected); err != nil {
+		s.t.Fatalf("jrpctest: %s: %s", s.Method, err)
+	} else if !ok {
+		s.t.Fatalf("jrpctest: %s: message %s, expected %s", s.Method, msg, mustJSON(expected))
+	}
+	return s
+}
+
+// Waits for the next message and decodes it into v
+func (s *Subscription) Decode(v interface{}) *Subscription {
+	s.t.Helper()
+	msg := s.Next()
+	if err := json.Unmarshal(msg, v); err != nil {
+		s.t.Fatalf("jrpctest: %s: decode message %s: %s", s.Method, msg, err)
+	}
+	return s
+}
+
+// Asserts that topic subscription was confirmed
+func (s *Subscription) ExpectSubscribed() *Subscription {
+	s.t.Helper()
+	return s.Expect("subscribed")
+}
+
+// Asserts that no message arrives for duration d
+func (s *Subscription) ExpectNone(d time.Duration) *Subscription {
+	s.t.Helper()
+	select {
+	case msg, ok := <-s.Sub.C:
+		if ok {
+			s.t.Fatalf("jrpctest: %s: unexpected message %s", s.Method, mustJSON(msg))
+		}
+	case <-time.After(d):
+	}
+	return s
+}
+
+// Asserts that the server ends subscription without error. Remaining
+// messages are skipped.
+func (s *Subscription) ExpectEnd() {
+	s.t.Helper()
+	if err := s.wait(); err != nil {
+		s.t.Fatalf("jrpctest: %s: subscription ended with error %s", s.Method, err)
+	}
+}
+
+// Asserts that the server ends subscription with error code. Remaining
+// messages are skipped.
+func (s *Subscription) ExpectEndError(code spec.ErrorCode) {
+	s.t.Helper()
+	err := s.wait()
+	var rpcErr *client.Error
+	if !errors.As(err, &rpcErr) || !hasCode(rpcErr, code) {
+		s.t.Fatalf("jrpctest: %s: expected subscription to end with error %d, got %v", s.Method, code, err)
+	}
+}
+
+// Unsubscribes and fails the test when the server returns error
+func (s *Subscription) Unsubscribe() {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.Sub.Unsubscribe(ctx); err != nil {
+		s.t.Fatalf("jrpctest: %s: unsubscribe: %s", s.Method, err)
+	}
+}
+
+// Waits until subscription ends and returns its error
+func (s *Subscription) wait() error {
+	s.t.Helper()
+	timeout := time.After(s.timeout)
+	for {
+		select {
+		case _, ok := <-s.Sub.C:
+			if !ok {
+				return s.Sub.Err()
+			}
+		case <-timeout:
+			s.t.Fatalf("jrpctest: %s: subscription did not end in %s", s.Method, s.timeout)
+			return nil
+		}
+	}
+}
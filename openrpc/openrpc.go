@@ -0,0 +1,91 @@
+package openrpc
+
+// Version of OpenRPC specification the documents follow
+const Version = "1.2.6"
+
+// Document describes methods of a json-rpc server.
+// See https://spec.open-rpc.org
+type Document struct {
+	OpenRPC    string      `json:"openrpc"`
+	Info       Info        `json:"info"`
+	Methods    []Method    `json:"methods"`
+	Components *Components `json:"components,omitempty"`
+}
+
+// Metadata of the described server
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Method that can be called by a client
+type Method struct {
+	// Name used in json-rpc request, i.e. "example.Simple"
+	Name string `json:"name"`
+
+	// Params are sent as an array, or as the object itself when method has
+	// a single object param ("by-name")
+	ParamStructure string              `json:"paramStructure,omitempty"`
+	Params         []ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor  `json:"result,omitempty"`
+
+	// Subscription methods send results until unsubscribed with
+	// XUnsubscribe method
+	XSubscription bool   `json:"x-subscription,omitempty"`
+	XUnsubscribe  string `json:"x-unsubscribe,omitempty"`
+
+	// Topic subscriptions accept any params passed to the topic filter
+	XTopic bool `json:"x-topic,omitempty"`
+
+	// Schema of the params object when ParamStructure is "by-name"
+	XParams *Schema `json:"x-params,omitempty"`
+}
+
+// Param or result of a method
+type ContentDescriptor struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// Reusable schemas referenced with "#/components/schemas/Name"
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Param structures of a method
+const (
+	ByPosition = "by-position"
+	ByName     = "by-name"
+)
+
+// Creates new document with info and empty components
+func New(title, version string) *Document {
+	return &Document{
+		OpenRPC:    Version,
+		Info:       Info{Title: title, Version: version},
+		Methods:    []Method{},
+		Components: &Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// Finds method by name
+func (d *Document) Method(name string) (Method, bool) {
+	for _, m := range d.Methods {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
+// Returns schema referenced by $ref or the schema itself
+func (d *Document) Resolve(s *Schema) *Schema {
+	if s == nil || s.Ref == "" || d.Components == nil {
+		return s
+	}
+	if ref, ok := d.Components.Schemas[RefName(s.Ref)]; ok {
+		return ref
+	}
+	return s
+}
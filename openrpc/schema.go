@@ -0,0 +1,160 @@
+package openrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Prefix of references to component schemas
+const refPrefix = "#/components/schemas/"
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	bytesType      = reflect.TypeOf([]byte{})
+)
+
+// JSON Schema of a param or result. Only the subset needed to describe Go
+// types is supported.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// Go type the schema was reflected from, i.e. "int64" or "example.Request"
+	XGoType string `json:"x-go-type,omitempty"`
+}
+
+// Returns component name of reference "#/components/schemas/Name"
+func RefName(ref string) string {
+	return strings.TrimPrefix(ref, refPrefix)
+}
+
+// Reflects Go type to schema. Named structs are added to components and
+// referenced with $ref. Pointers, including references, are nullable.
+// Field names follow encoding/json rules.
+func (d *Document) Reflect(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	s := d.reflect(t)
+	if nullable {
+		s.Nullable = true
+	}
+	return s
+}
+
+// Reflects non pointer type
+func (d *Document) reflect(t reflect.Type) *Schema {
+	goType := t.String()
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time", XGoType: goType}
+	case t == rawMessageType:
+		return &Schema{XGoType: goType}
+	case t == bytesType:
+		return &Schema{Type: "string", Format: "byte", XGoType: goType}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean", XGoType: goType}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", XGoType: goType}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", XGoType: goType}
+	case reflect.String:
+		return &Schema{Type: "string", XGoType: goType}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.Reflect(t.Elem()), XGoType: goType}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.Reflect(t.Elem()), XGoType: goType}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.reflectStruct(t)
+		}
+		name := d.componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Placeholder stops recursion of self referencing types
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.reflectStruct(t)
+		}
+		return &Schema{Ref: refPrefix + name}
+	}
+	// Interfaces and other kinds accept any value
+	return &Schema{XGoType: goType}
+}
+
+// Reflects struct fields to object properties
+func (d *Document) reflectStruct(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Title:      t.Name(),
+		Properties: map[string]*Schema{},
+		XGoType:    t.String(),
+	}
+	d.addFields(s, t)
+	return s
+}
+
+// Adds exported fields to properties. Embedded structs without json name
+// are flattened the same way as encoding/json does.
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			d.addFields(s, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.Reflect(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// Returns unique component name of a named type. Types with the same name
+// from different packages get package prefix.
+func (d *Document) componentName(t reflect.Type) string {
+	name := t.Name()
+	existing, ok := d.Components.Schemas[name]
+	if !ok || existing.XGoType == "" || existing.XGoType == t.String() {
+		return name
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "" {
+		return name
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
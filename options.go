@@ -0,0 +1,371 @@
+package jrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc/bus"
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/ratelimit"
+	"github.com/kroksys/jrpc/recorder"
+	"github.com/kroksys/jrpc/registry"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Option configures Server created with NewServer
+type Option func(*Server) error
+
+// Turns on/off logs for server and registry
+func WithLogs(logsOn bool) Option {
+	return func(s *Server) error {
+		s.LogsOn = logsOn
+		return nil
+	}
+}
+
+// Sets logger used when logs are turned on. Default is log.Default().
+func WithLogger(logger registry.Logger) Option {
+	return func(s *Server) error {
+		if logger == nil {
+			return errors.New("logger can not be nil")
+		}
+		s.Logger = logger
+		return nil
+	}
+}
+
+// Sets interval between pings sent to every connection
+func WithPingPeriod(d time.Duration) Option {
+	return func(s *Server) error {
+		s.PingPeriod = d
+		return nil
+	}
+}
+
+// Sets number of ping periods without pong or message after which
+// connection is closed. Zero disables the check.
+func WithMaxMissedPongs(n int) Option {
+	return func(s *Server) error {
+		s.MaxMissedPongs = n
+		return nil
+	}
+}
+
+// Sets duration after which connection without subscriptions and messages
+// is closed. Zero disables the check.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		s.IdleTimeout = d
+		return nil
+	}
+}
+
+// Sets maximum time for writing a single frame. Zero means no deadline.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		s.ConnConfig.WriteTimeout = d
+		return nil
+	}
+}
+
+// Sets number of outgoing messages that can wait to be written per connection
+func WithWriteQueueSize(n int) Option {
+	return func(s *Server) error {
+		s.ConnConfig.QueueSize = n
+		return nil
+	}
+}
+
+// Sets maximum size of received message in bytes. Zero means no limit.
+func WithReadLimit(n int64) Option {
+	return func(s *Server) error {
+		s.ConnConfig.MaxMessageSize = n
+		return nil
+	}
+}
+
+// Sets maximum size of a single received frame in bytes. Zero means no
+// limit (read limit still applies).
+func WithMaxFrameSize(n int64) Option {
+	return func(s *Server) error {
+		s.ConnConfig.MaxFrameSize = n
+		return nil
+	}
+}
+
+// Sets time to wait for response to a request sent to the client with
+// conn.Request when its context has no deadline. Zero means no timeout.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		s.ConnConfig.RequestTimeout = d
+		return nil
+	}
+}
+
+// Records every message received and sent by connections, i.e. to replay
+// traffic with recorder.Replay or cmd/jrpc-replay
+func WithRecorder(rec *recorder.Recorder) Option {
+	return func(s *Server) error {
+		if rec == nil {
+			return errors.New("recorder can not be nil")
+		}
+		s.ConnConfig.OnMessage = rec.Tap
+		return nil
+	}
+}
+
+// Sets maximum nesting depth of json arrays and objects in received message.
+// Zero means no limit.
+func WithMaxDepth(n int) Option {
+	return func(s *Server) error {
+		s.Limits.MaxDepth = n
+		return nil
+	}
+}
+
+// Sets maximum number of elements in request params. Zero means no limit.
+func WithMaxParams(n int) Option {
+	return func(s *Server) error {
+		s.Limits.MaxParams = n
+		return nil
+	}
+}
+
+// Sets maximum number of requests in a batch. Zero means no limit.
+func WithMaxBatch(n int) Option {
+	return func(s *Server) error {
+		s.Limits.MaxBatch = n
+		return nil
+	}
+}
+
+// Sets maximum number of calls executed at the same time across all
+// connections. Other calls wait for a free slot. Subscriptions are not
+// counted. Zero means no limit.
+func WithMaxConcurrentCalls(n int) Option {
+	return func(s *Server) error {
+		s.MaxConcurrentCalls = n
+		return nil
+	}
+}
+
+// Sets maximum number of calls executed at the same time on a single
+// connection. Calls over the limit wait in a queue of the same size.
+// Zero means no limit.
+func WithMaxInFlight(n int) Option {
+	return func(s *Server) error {
+		s.MaxInFlight = n
+		return nil
+	}
+}
+
+// Rejects calls with server busy error when connection reaches MaxInFlight
+// instead of waiting for a free slot.
+func WithRejectWhenBusy(reject bool) Option {
+	return func(s *Server) error {
+		s.RejectWhenBusy = reject
+		return nil
+	}
+}
+
+// Executes calls of a connection one by one in arrival order
+func WithSequential(sequential bool) Option {
+	return func(s *Server) error {
+		s.Sequential = sequential
+		return nil
+	}
+}
+
+// Sets codec used to decode incoming and encode outgoing messages
+func WithCodec(codec spec.Codec) Option {
+	return func(s *Server) error {
+		if codec == nil {
+			return errors.New("codec can not be nil")
+		}
+		s.Codec = codec
+		return nil
+	}
+}
+
+// Sets hook called when new connection is accepted
+func WithOnConnect(fn func(c *conn.Conn)) Option {
+	return func(s *Server) error {
+		s.OnConnect = fn
+		return nil
+	}
+}
+
+// Sets hook called when connection is closed with the close cause
+func WithOnDisconnect(fn func(c *conn.Conn, err error)) Option {
+	return func(s *Server) error {
+		s.OnDisconnect = fn
+		return nil
+	}
+}
+
+// Sets upgrader used to upgrade http connections to websocket
+func WithUpgrader(u ws.HTTPUpgrader) Option {
+	return func(s *Server) error {
+		s.Upgrader = u
+		return nil
+	}
+}
+
+// Sets origins allowed to open connections. Origin is either full origin
+// ("https://example.com") or host ("example.com") and can contain wildcards
+// ("https://*.example.com"). "*" allows any origin. Default is same origin.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *Server) error {
+		s.AllowedOrigins = append(s.AllowedOrigins, origins...)
+		return nil
+	}
+}
+
+// Sets subprotocols supported by the server in preferred order. Clients that
+// do not request any of them are rejected.
+func WithSubprotocols(protocols ...string) Option {
+	return func(s *Server) error {
+		s.Subprotocols = append(s.Subprotocols, protocols...)
+		return nil
+	}
+}
+
+// Sets headers added to every upgrade response
+func WithResponseHeader(header http.Header) Option {
+	return func(s *Server) error {
+		s.ResponseHeader = header
+		return nil
+	}
+}
+
+// Sets hook called when upgrade request is rejected with response status
+func WithOnUpgradeReject(fn func(r *http.Request, status int, err error)) Option {
+	return func(s *Server) error {
+		s.OnUpgradeReject = fn
+		return nil
+	}
+}
+
+// Sets bus used by Publish. Default is in-process bus.
+func WithBus(b bus.Bus) Option {
+	return func(s *Server) error {
+		if b == nil {
+			return errors.New("bus can not be nil")
+		}
+		s.bus = b
+		return nil
+	}
+}
+
+// Sets rate limits checked before every call. Calls over the limit are
+// answered with spec.RateLimitedCode error including seconds to wait.
+func WithRateLimits(config ratelimit.Config) Option {
+	return func(s *Server) error {
+		s.registryOpts = append(s.registryOpts, registry.WithRateLimiter(ratelimit.NewLimiter(config)))
+		return nil
+	}
+}
+
+// Sets quota limiting total cost of calls in a rolling window per principal,
+// or per connection when principal is not set. Method cost is declared with
+// registry.Cost when registering a service. Remaining quota is returned by
+// "rpc.Quota" method.
+func WithQuota(quota ratelimit.Quota) Option {
+	return func(s *Server) error {
+		s.registryOpts = append(s.registryOpts, registry.WithQuota(quota))
+		return nil
+	}
+}
+
+// Sets how method names of requests are resolved, i.e. separator, case of
+// method names and subscription name sent in params. Default is
+// registry.DefaultNaming.
+/*
+	jrpc.NewServer(jrpc.WithNaming(registry.EthereumNaming))
+*/
+func WithNaming(naming registry.Naming) Option {
+	return func(s *Server) error {
+		s.registryOpts = append(s.registryOpts, registry.WithNaming(naming))
+		return nil
+	}
+}
+
+// Sets router resolving method names of requests to registered methods.
+// Default is registry.DefaultRouter.
+func WithRouter(router registry.Router) Option {
+	return func(s *Server) error {
+		s.registryOpts = append(s.registryOpts, registry.WithRouter(router))
+		return nil
+	}
+}
+
+// Sets func resolving authenticated principal (i.e. user ID) from upgrade
+// request. Principal is stored in conn.Conn and used by per principal limits.
+func WithPrincipal(fn func(r *http.Request) string) Option {
+	return func(s *Server) error {
+		s.Principal = fn
+		return nil
+	}
+}
+
+// Adds options used to create server registry
+func WithRegistryOptions(opts ...registry.Option) Option {
+	return func(s *Server) error {
+		s.registryOpts = append(s.registryOpts, opts...)
+		return nil
+	}
+}
+
+// Checks that options are valid and do not conflict with each other
+func (s *Server) validate() error {
+	switch {
+	case s.PingPeriod <= 0:
+		return fmt.Errorf("ping period must be positive, got %s", s.PingPeriod)
+	case s.MaxMissedPongs < 0:
+		return fmt.Errorf("max missed pongs can not be negative, got %d", s.MaxMissedPongs)
+	case s.IdleTimeout < 0:
+		return fmt.Errorf("idle timeout can not be negative, got %s", s.IdleTimeout)
+	case s.IdleTimeout > 0 && s.IdleTimeout < s.PingPeriod:
+		return fmt.Errorf("idle timeout %s is checked every ping period and must not be shorter than ping period %s",
+			s.IdleTimeout, s.PingPeriod)
+	case s.ConnConfig.WriteTimeout < 0:
+		return fmt.Errorf("write timeout can not be negative, got %s", s.ConnConfig.WriteTimeout)
+	case s.ConnConfig.RequestTimeout < 0:
+		return fmt.Errorf("request timeout can not be negative, got %s", s.ConnConfig.RequestTimeout)
+	case s.ConnConfig.QueueSize <= 0:
+		return fmt.Errorf("write queue size must be positive, got %d", s.ConnConfig.QueueSize)
+	case s.ConnConfig.MaxMessageSize < 0:
+		return fmt.Errorf("read limit can not be negative, got %d", s.ConnConfig.MaxMessageSize)
+	case s.ConnConfig.MaxFrameSize < 0:
+		return fmt.Errorf("max frame size can not be negative, got %d", s.ConnConfig.MaxFrameSize)
+	case s.ConnConfig.MaxFrameSize > 0 && s.ConnConfig.MaxMessageSize > 0 &&
+		s.ConnConfig.MaxFrameSize > s.ConnConfig.MaxMessageSize:
+		return fmt.Errorf("max frame size %d can not be greater than read limit %d",
+			s.ConnConfig.MaxFrameSize, s.ConnConfig.MaxMessageSize)
+	case s.Limits.MaxDepth < 0 || s.Limits.MaxParams < 0 || s.Limits.MaxBatch < 0:
+		return fmt.Errorf("message limits can not be negative, got %+v", s.Limits)
+	case s.MaxInFlight < 0:
+		return fmt.Errorf("max in-flight calls can not be negative, got %d", s.MaxInFlight)
+	case s.RejectWhenBusy && s.MaxInFlight == 0:
+		return errors.New("reject when busy requires max in-flight calls to be set")
+	case s.hasInvalidOrigin():
+		return fmt.Errorf("invalid allowed origin pattern in %q", s.AllowedOrigins)
+	case s.MaxConcurrentCalls < 0:
+		return fmt.Errorf("max concurrent calls can not be negative, got %d", s.MaxConcurrentCalls)
+	}
+	return nil
+}
+
+// Checks if any allowed origin is an invalid pattern
+func (s *Server) hasInvalidOrigin() bool {
+	for _, origin := range s.AllowedOrigins {
+		if _, err := path.Match(origin, ""); err != nil {
+			return true
+		}
+	}
+	return false
+}
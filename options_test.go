@@ -0,0 +1,62 @@
+package jrpc_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+)
+
+func TestNewServerValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []jrpc.Option
+		err  string
+	}{
+		{"defaults", nil, ""},
+		{"valid limits", []jrpc.Option{jrpc.WithMaxInFlight(4), jrpc.WithRejectWhenBusy(true), jrpc.WithReadLimit(1024), jrpc.WithMaxFrameSize(512)}, ""},
+		{"reject without max in-flight", []jrpc.Option{jrpc.WithRejectWhenBusy(true)}, "reject when busy requires max in-flight"},
+		{"frame over read limit", []jrpc.Option{jrpc.WithReadLimit(1024), jrpc.WithMaxFrameSize(2048)}, "max frame size 2048 can not be greater than read limit 1024"},
+		{"idle timeout under ping period", []jrpc.Option{jrpc.WithPingPeriod(time.Second), jrpc.WithIdleTimeout(time.Millisecond * 500)}, "must not be shorter than ping period"},
+		{"zero ping period", []jrpc.Option{jrpc.WithPingPeriod(0)}, "ping period must be positive"},
+		{"negative missed pongs", []jrpc.Option{jrpc.WithMaxMissedPongs(-1)}, "max missed pongs can not be negative"},
+		{"negative idle timeout", []jrpc.Option{jrpc.WithIdleTimeout(-time.Second)}, "idle timeout can not be negative"},
+		{"negative write timeout", []jrpc.Option{jrpc.WithWriteTimeout(-time.Second)}, "write timeout can not be negative"},
+		{"negative request timeout", []jrpc.Option{jrpc.WithRequestTimeout(-time.Second)}, "request timeout can not be negative"},
+		{"zero write queue", []jrpc.Option{jrpc.WithWriteQueueSize(0)}, "write queue size must be positive"},
+		{"negative read limit", []jrpc.Option{jrpc.WithReadLimit(-1)}, "read limit can not be negative"},
+		{"negative frame size", []jrpc.Option{jrpc.WithMaxFrameSize(-1)}, "max frame size can not be negative"},
+		{"negative batch", []jrpc.Option{jrpc.WithMaxBatch(-1)}, "message limits can not be negative"},
+		{"negative depth", []jrpc.Option{jrpc.WithMaxDepth(-1)}, "message limits can not be negative"},
+		{"negative max in-flight", []jrpc.Option{jrpc.WithMaxInFlight(-1)}, "max in-flight calls can not be negative"},
+		{"negative concurrent calls", []jrpc.Option{jrpc.WithMaxConcurrentCalls(-1)}, "max concurrent calls can not be negative"},
+		{"bad origin pattern", []jrpc.Option{jrpc.WithAllowedOrigins("https://[example.com")}, "invalid allowed origin pattern"},
+		{"nil logger", []jrpc.Option{jrpc.WithLogger(nil)}, "logger can not be nil"},
+		{"nil codec", []jrpc.Option{jrpc.WithCodec(nil)}, "codec can not be nil"},
+	}
+	for _, test := range tests {
+		s, err := jrpc.NewServer(test.opts...)
+		if test.err == "" {
+			if err != nil || s == nil {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: got error %v, expected %q", test.name, err, test.err)
+		}
+		if s != nil {
+			t.Fatalf("%s: server returned with error", test.name)
+		}
+	}
+}
+
+func TestNewServerWithLogs(t *testing.T) {
+	for _, logsOn := range []bool{false, true} {
+		s := jrpc.NewServerWithLogs(logsOn)
+		if s == nil || s.Registry == nil || s.LogsOn != logsOn {
+			t.Fatalf("logs %v: unexpected server %+v", logsOn, s)
+		}
+	}
+}
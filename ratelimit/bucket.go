@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit describes token bucket. Rate is number of tokens added per second
+// and Burst is maximum number of tokens in the bucket. Limit with Rate <= 0
+// means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Checks if limit is set
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0
+}
+
+// Token bucket. Starts full and refills with Limit.Rate tokens per second.
+type Bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// Creates new full bucket
+func NewBucket(limit Limit) *Bucket {
+	return newBucket(limit, time.Now())
+}
+
+// Creates new full bucket last refilled at now
+func newBucket(limit Limit, now time.Time) *Bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &Bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// Takes n tokens if available. When there is not enough tokens returns false
+// and duration after which they will be available.
+func (b *Bucket) Take(n float64) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	wait := b.wait(n, time.Now())
+	if wait > 0 {
+		return wait, false
+	}
+	b.tokens -= n
+	return 0, true
+}
+
+// Refills the bucket and returns time to wait for n tokens
+func (b *Bucket) wait(n float64, now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.limit.Rate
+		b.last = now
+	}
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// Checks if bucket was not used for given duration
+func (b *Bucket) idle(now time.Time, d time.Duration) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return now.Sub(b.last) > d
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Buckets not used for this duration are removed
+	idleBucketTTL = time.Minute * 10
+	sweepPeriod   = time.Minute
+)
+
+// Config of Limiter. Zero Limit means no limit.
+type Config struct {
+	// Shared by all connections
+	Global Limit
+
+	// For every connection
+	PerConn Limit
+
+	// For every authenticated principal across its connections
+	PerPrincipal Limit
+
+	// For method name (i.e. "report.Generate") per principal, or per
+	// connection when principal is not set. Names are registered service
+	// and Go method names joined with ".", whatever naming or alias the
+	// client used. Names are case insensitive.
+	PerMethod map[string]Limit
+}
+
+// Limiter enforces token bucket rate limits globally, per connection,
+// per principal and per method.
+type Limiter struct {
+	config    Config
+	global    *Bucket
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// Creates new Limiter with given config
+func NewLimiter(config Config) *Limiter {
+	perMethod := make(map[string]Limit, len(config.PerMethod))
+	for method, limit := range config.PerMethod {
+		perMethod[strings.ToLower(method)] = limit
+	}
+	config.PerMethod = perMethod
+	l := &Limiter{
+		config:    config,
+		buckets:   make(map[string]*Bucket),
+		lastSweep: time.Now(),
+	}
+	if !config.Global.IsZero() {
+		l.global = NewBucket(config.Global)
+	}
+	return l
+}
+
+// Takes one token from every bucket that applies to the call. Tokens are
+// taken only if all buckets allow the call, otherwise returns false and the
+// longest duration to wait before retrying.
+func (l *Limiter) Allow(connID, principal, method string) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.sweep(now)
+
+	buckets := []*Bucket{}
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if !l.config.PerConn.IsZero() {
+		buckets = append(buckets, l.bucket("conn:"+connID, l.config.PerConn, now))
+	}
+	if principal != "" && !l.config.PerPrincipal.IsZero() {
+		buckets = append(buckets, l.bucket("principal:"+principal, l.config.PerPrincipal, now))
+	}
+	method = strings.ToLower(method)
+	if limit, ok := l.config.PerMethod[method]; ok && !limit.IsZero() {
+		owner := "conn:" + connID
+		if principal != "" {
+			owner = "principal:" + principal
+		}
+		buckets = append(buckets, l.bucket("method:"+method+":"+owner, limit, now))
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		b.lock.Lock()
+		if w := b.wait(1, now); w > wait {
+			wait = w
+		}
+		b.lock.Unlock()
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, b := range buckets {
+		b.lock.Lock()
+		b.tokens--
+		b.lock.Unlock()
+	}
+	return 0, true
+}
+
+// Returns bucket for the key creating it when missing
+func (l *Limiter) bucket(key string, limit Limit, now time.Time) *Bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(limit, now)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Removes buckets of closed connections and inactive principals
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepPeriod {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.idle(now, idleBucketTTL) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowsBurst(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		conn   string
+		prin   string
+		method string
+	}{
+		{"per conn burst 1", Config{PerConn: Limit{Rate: 1, Burst: 1}}, "c1", "", "a.b"},
+		{"per conn burst 5", Config{PerConn: Limit{Rate: 1, Burst: 5}}, "c1", "", "a.b"},
+		{"per principal", Config{PerPrincipal: Limit{Rate: 1, Burst: 3}}, "c1", "user", "a.b"},
+		{"per method", Config{PerMethod: map[string]Limit{"Report.Generate": {Rate: 1, Burst: 2}}}, "c1", "", "report.generate"},
+		{"global", Config{Global: Limit{Rate: 1, Burst: 4}}, "c1", "", "a.b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.config)
+			burst := burstOf(tt.config)
+			for i := 0; i < burst; i++ {
+				if wait, ok := l.Allow(tt.conn, tt.prin, tt.method); !ok {
+					t.Fatalf("call %d of burst %d rejected, wait %s", i+1, burst, wait)
+				}
+			}
+			wait, ok := l.Allow(tt.conn, tt.prin, tt.method)
+			if ok {
+				t.Fatalf("call over burst %d allowed", burst)
+			}
+			if wait <= 0 || wait > time.Second {
+				t.Fatalf("wait %s, expected up to 1s", wait)
+			}
+		})
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := NewLimiter(Config{
+		PerConn:   Limit{Rate: 1, Burst: 1},
+		PerMethod: map[string]Limit{"report.generate": {Rate: 1, Burst: 1}},
+	})
+	if _, ok := l.Allow("c1", "", "report.generate"); !ok {
+		t.Fatal("first call of c1 rejected")
+	}
+	if _, ok := l.Allow("c2", "", "report.generate"); !ok {
+		t.Fatal("first call of c2 rejected, connections must not share buckets")
+	}
+	if _, ok := l.Allow("c1", "", "report.list"); ok {
+		t.Fatal("second call of c1 allowed")
+	}
+}
+
+func TestLimiterDoesNotTakeTokensWhenRejected(t *testing.T) {
+	l := NewLimiter(Config{
+		PerConn:   Limit{Rate: 1, Burst: 2},
+		PerMethod: map[string]Limit{"a.slow": {Rate: 1, Burst: 1}},
+	})
+	l.Allow("c1", "", "a.slow")
+	if _, ok := l.Allow("c1", "", "a.slow"); ok {
+		t.Fatal("method limit not applied")
+	}
+	if _, ok := l.Allow("c1", "", "a.fast"); !ok {
+		t.Fatal("rejected call took connection token")
+	}
+}
+
+func TestBucketRefills(t *testing.T) {
+	now := time.Now()
+	b := newBucket(Limit{Rate: 10, Burst: 1}, now)
+	if w := b.wait(1, now); w != 0 {
+		t.Fatalf("full bucket wait %s", w)
+	}
+	b.tokens--
+	if w := b.wait(1, now.Add(-time.Second)); w <= 0 {
+		t.Fatal("time going back refilled bucket")
+	}
+	if w := b.wait(1, now.Add(time.Millisecond*100)); w != 0 {
+		t.Fatalf("bucket not refilled, wait %s", w)
+	}
+}
+
+// Returns the smallest burst of configured limits
+func burstOf(c Config) int {
+	burst := 0
+	for _, l := range append([]Limit{c.Global, c.PerConn, c.PerPrincipal}, methodLimits(c)...) {
+		if !l.IsZero() && (burst == 0 || l.Burst < burst) {
+			burst = l.Burst
+		}
+	}
+	return burst
+}
+
+func methodLimits(c Config) []Limit {
+	limits := []Limit{}
+	for _, l := range c.PerMethod {
+		limits = append(limits, l)
+	}
+	return limits
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of slots rolling window is divided into
+const quotaSlots = 60
+
+// Quota limits total cost of calls made in a rolling window.
+// Limit <= 0 means no quota.
+type Quota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Cost used in the rolling window of a single key
+type usage struct {
+	costs  [quotaSlots]int
+	epochs [quotaSlots]int64
+	last   time.Time
+}
+
+// QuotaTracker keeps track of cost used by principals or connections
+type QuotaTracker struct {
+	quota     Quota
+	slot      time.Duration
+	usage     map[string]*usage
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// Creates new QuotaTracker for given quota
+func NewQuotaTracker(quota Quota) *QuotaTracker {
+	slot := quota.Window / quotaSlots
+	if slot <= 0 {
+		slot = time.Millisecond
+	}
+	return &QuotaTracker{
+		quota:     quota,
+		slot:      slot,
+		usage:     make(map[string]*usage),
+		lastSweep: time.Now(),
+	}
+}
+
+// Returns tracked quota
+func (t *QuotaTracker) Quota() Quota {
+	return t.quota
+}
+
+// Uses cost from the quota of the key if enough is remaining. Returns
+// remaining cost and duration after which some of the used cost is freed.
+func (t *QuotaTracker) Use(key string, cost int) (int, time.Duration, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	t.sweep(now)
+	u, ok := t.usage[key]
+	if !ok {
+		u = &usage{}
+		t.usage[key] = u
+	}
+	used, reset := t.used(u, now)
+	if used+cost > t.quota.Limit {
+		return t.quota.Limit - used, reset, false
+	}
+	epoch := now.UnixNano() / int64(t.slot)
+	i := epoch % quotaSlots
+	if u.epochs[i] != epoch {
+		u.epochs[i] = epoch
+		u.costs[i] = 0
+	}
+	u.costs[i] += cost
+	u.last = now
+	used, reset = t.used(u, now)
+	return t.quota.Limit - used, reset, true
+}
+
+// Returns remaining cost of the key and duration after which some of the
+// used cost is freed.
+func (t *QuotaTracker) Remaining(key string) (int, time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	u, ok := t.usage[key]
+	if !ok {
+		return t.quota.Limit, 0
+	}
+	used, reset := t.used(u, time.Now())
+	return t.quota.Limit - used, reset
+}
+
+// Sums cost used in the window and finds when the oldest used slot expires
+func (t *QuotaTracker) used(u *usage, now time.Time) (int, time.Duration) {
+	epoch := now.UnixNano() / int64(t.slot)
+	used := 0
+	oldest := int64(-1)
+	for i := range u.epochs {
+		if u.costs[i] == 0 || u.epochs[i] <= epoch-quotaSlots {
+			continue
+		}
+		used += u.costs[i]
+		if oldest == -1 || u.epochs[i] < oldest {
+			oldest = u.epochs[i]
+		}
+	}
+	if oldest == -1 {
+		return used, 0
+	}
+	expires := time.Unix(0, (oldest+quotaSlots)*int64(t.slot))
+	return used, expires.Sub(now)
+}
+
+// Removes usage of keys that were not used for the whole window
+func (t *QuotaTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.quota.Window {
+		return
+	}
+	t.lastSweep = now
+	for key, u := range t.usage {
+		if now.Sub(u.last) > t.quota.Window {
+			delete(t.usage, key)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaTrackerUse(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		costs     []int
+		allowed   []bool
+		remaining int
+	}{
+		{"within limit", 10, []int{3, 3, 4}, []bool{true, true, true}, 0},
+		{"over limit", 5, []int{3, 3, 2}, []bool{true, false, true}, 0},
+		{"cost above limit", 5, []int{6, 1}, []bool{false, true}, 4},
+		{"free calls", 1, []int{0, 1, 0, 1}, []bool{true, true, true, false}, 0},
+	}
+	for _, test := range tests {
+		tracker := NewQuotaTracker(Quota{Limit: test.limit, Window: time.Hour})
+		for i, cost := range test.costs {
+			if _, _, ok := tracker.Use("key", cost); ok != test.allowed[i] {
+				t.Fatalf("%s: call %d with cost %d allowed %v, expected %v", test.name, i, cost, ok, test.allowed[i])
+			}
+		}
+		if remaining, _ := tracker.Remaining("key"); remaining != test.remaining {
+			t.Fatalf("%s: remaining %d, expected %d", test.name, remaining, test.remaining)
+		}
+	}
+}
+
+func TestQuotaTrackerKeys(t *testing.T) {
+	tracker := NewQuotaTracker(Quota{Limit: 1, Window: time.Hour})
+	for _, key := range []string{"principal:alice", "principal:bob", "conn:1"} {
+		if _, _, ok := tracker.Use(key, 1); !ok {
+			t.Fatalf("%s: first call rejected", key)
+		}
+	}
+	if remaining, _ := tracker.Remaining("principal:carol"); remaining != 1 {
+		t.Fatalf("unused key has remaining %d, expected 1", remaining)
+	}
+}
+
+func TestQuotaTrackerWindow(t *testing.T) {
+	window := time.Millisecond * 120
+	tracker := NewQuotaTracker(Quota{Limit: 1, Window: window})
+	if _, _, ok := tracker.Use("key", 1); !ok {
+		t.Fatal("first call rejected")
+	}
+	_, reset, ok := tracker.Use("key", 1)
+	if ok {
+		t.Fatal("second call allowed within window")
+	}
+	if reset <= 0 || reset > window {
+		t.Fatalf("reset %s, expected within window %s", reset, window)
+	}
+	time.Sleep(reset + tracker.slot)
+	if _, _, ok := tracker.Use("key", 1); !ok {
+		t.Fatal("call rejected after window passed")
+	}
+}
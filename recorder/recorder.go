@@ -0,0 +1,170 @@
+// Package recorder writes every message received and sent by server
+// connections to a JSONL file and replays recordings against a server,
+// comparing its responses with the recorded ones.
+/*
+	rec, err := recorder.Create("traffic.jsonl")
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+	jrpcServer, err := jrpc.NewServer(jrpc.WithRecorder(rec))
+*/
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kroksys/jrpc/conn"
+)
+
+// Direction of recorded message as seen by the server
+type Direction string
+
+const (
+	In  Direction = "in"
+	Out Direction = "out"
+)
+
+// Recorded message. Message that is not valid json is kept in Text.
+type Entry struct {
+	Time    time.Time       `json:"time"`
+	Conn    string          `json:"conn"`
+	Dir     Direction       `json:"dir"`
+	Message json.RawMessage `json:"msg,omitempty"`
+	Text    string          `json:"text,omitempty"`
+}
+
+// Returns message as it was received or sent
+func (e Entry) Data() []byte {
+	if e.Message != nil {
+		return e.Message
+	}
+	return []byte(e.Text)
+}
+
+// Recorder writes entries to JSONL file, one entry per line. It is safe
+// for concurrent use.
+type Recorder struct {
+	w      io.Writer
+	closer io.Closer
+	err    error
+	lock   sync.Mutex
+}
+
+// Creates recorder writing to w
+func New(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Creates recorder appending to file at path
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{w: f, closer: f}, nil
+}
+
+// Records message of connection. Used as conn.Config.OnMessage.
+func (r *Recorder) Tap(c *conn.Conn, inbound bool, msg []byte) {
+	dir := Out
+	if inbound {
+		dir = In
+	}
+	r.Record(c.ID, dir, msg)
+}
+
+// Writes entry with current time. Returns first write error, following
+// entries are not written after it.
+func (r *Recorder) Record(connID string, dir Direction, msg []byte) error {
+	e := Entry{Time: time.Now(), Conn: connID, Dir: dir}
+	if json.Valid(msg) {
+		e.Message = json.RawMessage(msg)
+	} else {
+		e.Text = string(msg)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	_, r.err = r.w.Write(data)
+	return r.err
+}
+
+// Returns first write error
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Closes file opened by Create. Entries are not written after Close.
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err == nil {
+		r.err = errors.New("recorder is closed")
+	}
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Reads entries of a recording
+func Read(rd io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Reads entries of a recording file
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Error of a line that is not a valid entry
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("recording line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
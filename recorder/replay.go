@@ -0,0 +1,325 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc/conn"
+)
+
+// Default time to wait for responses after the last message is sent
+const DefaultReplayWait = time.Second * 5
+
+// Opens websocket connection to the server replaying a recording
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// Option configures Replay
+type Option func(*replayConfig) error
+
+// Settings of Replay
+type replayConfig struct {
+	keepTiming bool
+	wait       time.Duration
+	ignore     map[string]bool
+}
+
+// Sends messages with the same gaps between them as they were recorded.
+// Needed when recording has subscriptions unsubscribed after some messages.
+func KeepTiming() Option {
+	return func(c *replayConfig) error {
+		c.keepTiming = true
+		return nil
+	}
+}
+
+// Sets time to wait for responses after the last message is sent
+func WithWait(d time.Duration) Option {
+	return func(c *replayConfig) error {
+		if d < 0 {
+			return errors.New("replay wait can not be negative")
+		}
+		c.wait = d
+		return nil
+	}
+}
+
+// Ignores object keys at any depth when comparing messages, i.e. keys
+// with timestamps or generated ids
+func Ignore(keys ...string) Option {
+	return func(c *replayConfig) error {
+		for _, key := range keys {
+			c.ignore[key] = true
+		}
+		return nil
+	}
+}
+
+// Difference between recorded message and message sent by the server
+// during replay. Recorded or Replayed is nil when message is missing.
+type Diff struct {
+	// Connection ID from the recording
+	Conn string
+
+	// Response id ("id:1") or method of server request ("method:ui.confirm")
+	Key string
+
+	// Position of message among messages with the same key, i.e. n-th
+	// subscription message
+	Index int
+
+	Recorded json.RawMessage
+	Replayed json.RawMessage
+}
+
+func (d Diff) String() string {
+	recorded, replayed := string(d.Recorded), string(d.Replayed)
+	if d.Recorded == nil {
+		recorded = "(missing)"
+	}
+	if d.Replayed == nil {
+		replayed = "(missing)"
+	}
+	return fmt.Sprintf("conn %s %s[%d]:\n  - %s\n  + %s", d.Conn, d.Key, d.Index, recorded, replayed)
+}
+
+// Replays inbound messages of the recording in recorded order, every
+// recorded connection on its own connection opened with dial. Returns
+// differences between recorded outbound messages and messages sent by the
+// server. Responses are matched by id, so concurrent calls may be answered
+// in any order.
+/*
+	entries, _ := recorder.ReadFile("traffic.jsonl")
+	diffs, err := recorder.Replay(ctx, entries, recorder.WebsocketDialer("ws://localhost:3333/ws"))
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+*/
+func Replay(ctx context.Context, entries []Entry, dial Dialer, opts ...Option) ([]Diff, error) {
+	cfg := &replayConfig{wait: DefaultReplayWait, ignore: map[string]bool{}}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	order := []string{}
+	conns := map[string]*replayConn{}
+	for _, e := range entries {
+		rc, ok := conns[e.Conn]
+		if !ok {
+			rc = &replayConn{recorded: map[string][]json.RawMessage{}, replayed: map[string][]json.RawMessage{}}
+			conns[e.Conn] = rc
+			order = append(order, e.Conn)
+		}
+		if e.Dir == Out {
+			rc.add(rc.recorded, e.Data())
+		}
+	}
+	defer func() {
+		for _, rc := range conns {
+			if rc.conn != nil {
+				rc.conn.Close()
+				<-rc.conn.Done()
+			}
+		}
+	}()
+	for _, id := range order {
+		cn, err := dial(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("dial for conn %s: %w", id, err)
+		}
+		rc := conns[id]
+		rc.conn = conn.NewClientConn(cn, conn.DefaultConfig())
+		go rc.collect()
+	}
+
+	var last time.Time
+	for _, e := range entries {
+		if e.Dir != In {
+			continue
+		}
+		if cfg.keepTiming && !last.IsZero() {
+			select {
+			case <-time.After(e.Time.Sub(last)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		last = e.Time
+		if err := conns[e.Conn].conn.Send(e.Data()); err != nil {
+			return nil, fmt.Errorf("send to conn %s: %w", e.Conn, err)
+		}
+	}
+
+	deadline := time.Now().Add(cfg.wait)
+	for time.Now().Before(deadline) && !complete(conns) {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	diffs := []Diff{}
+	for _, id := range order {
+		diffs = append(diffs, conns[id].diff(id, cfg.ignore)...)
+	}
+	return diffs, nil
+}
+
+// Dials websocket url, i.e. "ws://localhost:3333/ws"
+func WebsocketDialer(url string) Dialer {
+	return func(ctx context.Context) (net.Conn, error) {
+		cn, br, _, err := ws.Dial(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		// Server may have sent frames right after handshake
+		return conn.Buffered(cn, br), nil
+	}
+}
+
+// Recorded connection being replayed
+type replayConn struct {
+	conn     *conn.Conn
+	recorded map[string][]json.RawMessage
+	replayed map[string][]json.RawMessage
+	lock     sync.Mutex
+}
+
+// Collects messages sent by the server until connection is closed
+func (rc *replayConn) collect() {
+	for msg := range rc.conn.In {
+		rc.lock.Lock()
+		rc.add(rc.replayed, msg)
+		rc.lock.Unlock()
+	}
+}
+
+// Adds message to messages by key. Batch responses are split.
+func (rc *replayConn) add(messages map[string][]json.RawMessage, msg []byte) {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err == nil {
+		for _, m := range batch {
+			rc.add(messages, m)
+		}
+		return
+	}
+	key := messageKey(msg)
+	messages[key] = append(messages[key], json.RawMessage(msg))
+}
+
+// Checks if every recorded message was replayed
+func complete(conns map[string]*replayConn) bool {
+	for _, rc := range conns {
+		rc.lock.Lock()
+		for key, recorded := range rc.recorded {
+			if len(rc.replayed[key]) < len(recorded) {
+				rc.lock.Unlock()
+				return false
+			}
+		}
+		rc.lock.Unlock()
+	}
+	return true
+}
+
+// Compares recorded and replayed messages
+func (rc *replayConn) diff(id string, ignore map[string]bool) []Diff {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	keys := []string{}
+	for key := range rc.recorded {
+		keys = append(keys, key)
+	}
+	for key := range rc.replayed {
+		if _, ok := rc.recorded[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []Diff{}
+	for _, key := range keys {
+		recorded, replayed := rc.recorded[key], rc.replayed[key]
+		for i := 0; i < len(recorded) || i < len(replayed); i++ {
+			d := Diff{Conn: id, Key: key, Index: i}
+			if i < len(recorded) {
+				d.Recorded = recorded[i]
+			}
+			if i < len(replayed) {
+				d.Replayed = replayed[i]
+			}
+			if d.Recorded != nil && d.Replayed != nil && normalize(d.Recorded, ignore) == normalize(d.Replayed, ignore) {
+				continue
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+// Returns key matching recorded and replayed message. Responses are
+// matched by id, requests and notifications sent by the server by method.
+func messageKey(msg []byte) string {
+	var m struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return "invalid"
+	}
+	if m.Method != "" {
+		return "method:" + m.Method
+	}
+	if m.ID == nil {
+		return "id:null"
+	}
+	return "id:" + string(m.ID)
+}
+
+// Returns canonical json of message without ignored keys
+func normalize(msg []byte, ignore map[string]bool) string {
+	var v interface{}
+	if err := json.Unmarshal(msg, &v); err != nil {
+		return string(msg)
+	}
+	data, _ := json.Marshal(strip(v, ignore))
+	return string(data)
+}
+
+// Removes ignored keys from objects at any depth
+func strip(v interface{}, ignore map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ignore[key] {
+				delete(v, key)
+				continue
+			}
+			v[key] = strip(value, ignore)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = strip(v[i], ignore)
+		}
+	}
+	return v
+}
+
+// Formats diffs one per paragraph
+func Format(diffs []Diff) string {
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,131 @@
+package recorder_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/jrpctest"
+	"github.com/kroksys/jrpc/recorder"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Service with a result that depends on its offset and one that changes
+// on every call
+type Calc struct {
+	offset int
+}
+
+func (c Calc) Add(x, y int) int {
+	return x + y + c.offset
+}
+
+func (Calc) Info() map[string]interface{} {
+	return map[string]interface{}{"name": "calc", "time": time.Now().UnixNano()}
+}
+
+func newCalcServer(t *testing.T, offset int, opts ...jrpc.Option) *jrpc.Server {
+	t.Helper()
+	s, err := jrpc.NewServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("calc", Calc{offset: offset}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Dials connections served by s through net.Pipe
+func pipeDialer(s *jrpc.Server) recorder.Dialer {
+	return func(ctx context.Context) (net.Conn, error) {
+		server, client := net.Pipe()
+		go s.ServeConn(context.Background(), server)
+		return client, nil
+	}
+}
+
+// Records calls made on two connections and returns recorded entries
+func record(t *testing.T) []recorder.Entry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	rec, err := recorder.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	s := newCalcServer(t, 0, jrpc.WithRecorder(rec))
+	for i := 0; i < 2; i++ {
+		h := jrpctest.New(t, s)
+		h.Call(t, "calc.Add", []int{i, 2}).Expect(i + 2)
+		h.Call(t, "calc.Info", nil).ExpectOK()
+		h.Call(t, "calc.Missing", nil).ExpectError(spec.MethodNotFoundCode)
+	}
+
+	// Every call is recorded as received request and sent response
+	deadline := time.Now().Add(jrpctest.DefaultTimeout)
+	for {
+		entries, err := recorder.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 12 {
+			return entries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recorded %d entries, expected 12", len(entries))
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	entries := record(t)
+	conns := map[string]int{}
+	for _, e := range entries {
+		if e.Dir == recorder.In {
+			conns[e.Conn]++
+		}
+	}
+	if len(conns) != 2 {
+		t.Fatalf("expected requests of 2 connections, got %v", conns)
+	}
+
+	replay := func(s *jrpc.Server, opts ...recorder.Option) []recorder.Diff {
+		t.Helper()
+		diffs, err := recorder.Replay(context.Background(), entries, pipeDialer(s), append(opts, recorder.WithWait(time.Second))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return diffs
+	}
+
+	// Same server answers the same, except the time
+	if diffs := replay(newCalcServer(t, 0), recorder.Ignore("time")); len(diffs) != 0 {
+		t.Fatalf("unexpected differences\n%s", recorder.Format(diffs))
+	}
+	diffs := replay(newCalcServer(t, 0))
+	if len(diffs) != 2 {
+		t.Fatalf("expected time of calc.Info to differ on both connections\n%s", recorder.Format(diffs))
+	}
+	for _, d := range diffs {
+		if !strings.Contains(string(d.Recorded), `"time"`) {
+			t.Fatalf("unexpected difference %s", d)
+		}
+	}
+
+	// Server with changed behaviour
+	diffs = replay(newCalcServer(t, 1), recorder.Ignore("time"))
+	if len(diffs) != 2 {
+		t.Fatalf("expected calc.Add to differ on both connections\n%s", recorder.Format(diffs))
+	}
+	for _, d := range diffs {
+		if !strings.Contains(string(d.Recorded), `"result":`) || string(d.Recorded) == string(d.Replayed) {
+			t.Fatalf("unexpected difference %s", d)
+		}
+	}
+}
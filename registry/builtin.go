@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+// Name of the service with built-in methods registered with every Registry
+const BuiltinService = "rpc"
+
+// Built-in methods available to every client
+type builtin struct {
+	reg *Registry
+}
+
+// Quota status returned by rpc.Quota
+type QuotaStatus struct {
+	// Total cost allowed in the window. Zero means there is no quota.
+	Limit int `json:"limit"`
+
+	// Rolling window in seconds
+	Window float64 `json:"window"`
+
+	// Cost remaining in the current window
+	Remaining int `json:"remaining"`
+
+	// Seconds after which some of the used cost is freed
+	ResetAfter float64 `json:"resetAfter"`
+}
+
+// Returns remaining quota of the calling principal or connection so clients
+// can throttle themselves.
+// {"jsonrpc":"2.0","method":"rpc.Quota","id":1}
+func (b builtin) Quota(ctx context.Context) (QuotaStatus, error) {
+	if b.reg.Quota == nil {
+		return QuotaStatus{}, nil
+	}
+	c, ok := ConnFromContext(ctx)
+	if !ok {
+		return QuotaStatus{}, errors.New("missing connection")
+	}
+	quota := b.reg.Quota.Quota()
+	remaining, reset := b.reg.Quota.Remaining(quotaKey(c))
+	return QuotaStatus{
+		Limit:      quota.Limit,
+		Window:     quota.Window.Seconds(),
+		Remaining:  remaining,
+		ResetAfter: math.Ceil(reset.Seconds()*1000) / 1000,
+	}, nil
+}
+
+// Returns OpenRPC document describing methods of the server.
+// {"jsonrpc":"2.0","method":"rpc.Discover","id":1}
+func (b builtin) Discover() (*openrpc.Document, error) {
+	return b.reg.Document(), nil
+}
@@ -0,0 +1,21 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/kroksys/jrpc/conn"
+)
+
+type connKey struct{}
+
+// Returns context carrying connection that made the call
+func WithConn(ctx context.Context, c *conn.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// Returns connection that made the call. Methods taking context.Context
+// as first argument can use it to get the calling connection.
+func ConnFromContext(ctx context.Context) (*conn.Conn, bool) {
+	c, ok := ctx.Value(connKey{}).(*conn.Conn)
+	return c, ok
+}
@@ -0,0 +1,225 @@
+package registry
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kroksys/jrpc/codegen"
+	"github.com/kroksys/jrpc/openrpc"
+)
+
+// MethodKind tells how a registered method is called
+type MethodKind int
+
+const (
+	// Method called with "service.Method" returning a single response
+	KindCall MethodKind = iota
+
+	// Subscription method called with "service.subscribe.Method" sending
+	// messages until unsubscribed
+	KindSubscription
+
+	// Topic subscribed with "service.subscribe.topic" receiving published
+	// messages until unsubscribed
+	KindTopic
+)
+
+func (k MethodKind) String() string {
+	switch k {
+	case KindSubscription:
+		return "subscription"
+	case KindTopic:
+		return "topic"
+	}
+	return "call"
+}
+
+// MethodInfo describes registered method as seen by clients
+type MethodInfo struct {
+	// Name used in json-rpc request according to registry naming, i.e.
+	// "example.Simple" or "example.subscribe.Subscription"
+	Name string
+
+	// Name used to stop subscription, empty for calls
+	Unsubscribe string
+
+	Service string
+	Kind    MethodKind
+
+	// Types of params without context and subscription
+	Params []reflect.Type
+
+	// Type of call result or type of subscription messages when declared
+	// with Payload. Nil when unknown or method returns only error.
+	Result reflect.Type
+
+	// Cost of a call used by quota
+	Cost int
+}
+
+// Returns method name with types of params and result, i.e.
+// "example.Simple(int, int) int"
+func (info MethodInfo) Signature() string {
+	params := make([]string, len(info.Params))
+	for i, t := range info.Params {
+		params[i] = t.String()
+	}
+	signature := info.Name + "(" + strings.Join(params, ", ") + ")"
+	if info.Result != nil {
+		signature += " " + info.Result.String()
+	}
+	return signature
+}
+
+// Returns registered methods, subscriptions and topics sorted by name
+func (reg *Registry) Methods() []MethodInfo {
+	infos := []MethodInfo{}
+	n := reg.Naming
+	reg.services.Each(func(s Service) {
+		infos = append(infos, reg.serviceMethods(s)...)
+	})
+	reg.topics.Each(func(t *Topic) {
+		i := strings.LastIndex(t.Name, ".")
+		service, name := t.Name[:i], t.Name[i+1:]
+		infos = append(infos, MethodInfo{
+			Name:        n.join(service, "subscribe", name),
+			Unsubscribe: n.join(service, "unsubscribe", name),
+			Service:     service,
+			Kind:        KindTopic,
+		})
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Returns methods and subscriptions of a service sorted by name
+func (reg *Registry) serviceMethods(s Service) []MethodInfo {
+	infos := []MethodInfo{}
+	n := reg.Naming
+	for _, m := range s.methods {
+		infos = append(infos, MethodInfo{
+			Name:    n.join(s.Name, n.transform(m.name)),
+			Service: s.Name,
+			Kind:    KindCall,
+			Params:  m.args,
+			Result:  m.resultType(),
+			Cost:    m.cost,
+		})
+	}
+	for _, m := range s.subscriptions {
+		infos = append(infos, MethodInfo{
+			Name:        n.join(s.Name, "subscribe", n.transform(m.name)),
+			Unsubscribe: n.join(s.Name, "unsubscribe", n.transform(m.name)),
+			Service:     s.Name,
+			Kind:        KindSubscription,
+			Params:      m.args,
+			Result:      m.payload,
+			Cost:        m.cost,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Creates OpenRPC document describing registered methods. Built-in methods
+// are not included.
+func (reg *Registry) Document() *openrpc.Document {
+	doc := openrpc.New(reg.Info.Title, reg.Info.Version)
+	for _, info := range reg.Methods() {
+		if info.Service == BuiltinService {
+			continue
+		}
+		m := openrpc.Method{
+			Name:           info.Name,
+			ParamStructure: openrpc.ByPosition,
+			Params:         []openrpc.ContentDescriptor{},
+			XSubscription:  info.Kind != KindCall,
+			XUnsubscribe:   info.Unsubscribe,
+			XTopic:         info.Kind == KindTopic,
+		}
+		if len(info.Params) == 1 && isStructType(info.Params[0]) {
+			// Single struct param is sent as params object
+			m.ParamStructure = openrpc.ByName
+			m.XParams = doc.Reflect(info.Params[0])
+			params := doc.Resolve(m.XParams)
+			for _, name := range sortedKeys(params.Properties) {
+				m.Params = append(m.Params, openrpc.ContentDescriptor{
+					Name:     name,
+					Required: contains(params.Required, name),
+					Schema:   params.Properties[name],
+				})
+			}
+		} else {
+			for i, t := range info.Params {
+				m.Params = append(m.Params, openrpc.ContentDescriptor{
+					Name:     "arg" + strconv.Itoa(i),
+					Required: true,
+					Schema:   doc.Reflect(t),
+				})
+			}
+		}
+		if info.Result != nil || info.Kind != KindCall {
+			m.Result = &openrpc.ContentDescriptor{
+				Name:   "result",
+				Schema: doc.Reflect(info.Result),
+			}
+		}
+		doc.Methods = append(doc.Methods, m)
+	}
+	return doc
+}
+
+// Generates TypeScript client module with typed interfaces and a method per
+// registered call and subscription. Frontends can serve or commit it.
+/*
+	src, err := reg.TypeScript()
+	os.WriteFile("web/src/jrpc.ts", src, 0644)
+*/
+func (reg *Registry) TypeScript() ([]byte, error) {
+	return codegen.TypeScript(reg.Document())
+}
+
+// Returns type of the first output that is not error
+func (m *Method) resultType() reflect.Type {
+	t := m.fn.Type()
+	for i := 0; i < t.NumOut(); i++ {
+		if i != m.errPos {
+			return t.Out(i)
+		}
+	}
+	return nil
+}
+
+// Checks if type is a struct or pointer to struct
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// Returns map keys in sorted order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Checks if list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeScriptUsesUnsubscribeMethod(t *testing.T) {
+	tests := []struct {
+		naming   Naming
+		service  string
+		expected string
+	}{
+		{DefaultNaming, "billing.invoices", `("billing.invoices.subscribe.Watch", "billing.invoices.unsubscribe.Watch", `},
+		{EthereumNaming, "eth", `("eth_subscribe_watch", "eth_unsubscribe_watch", `},
+		{Naming{Separator: "/", Case: CaseExact}, "feed", `("feed/subscribe/Watch", "feed/unsubscribe/Watch", `},
+	}
+	for _, test := range tests {
+		reg, err := NewRegistry(WithNaming(test.naming))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Register(test.service, Slow{}); err != nil {
+			t.Fatal(err)
+		}
+		src, err := reg.TypeScript()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(src), test.expected) {
+			t.Fatalf("%s: generated client does not contain %s", test.service, test.expected)
+		}
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 // Method represents function in struct to be called.
-// Registering struct with registry reflects all methods as Method
+// Registering struct with registry reflects all methods as Method.
+// Functions registered with RegisterFunc do not have receiver.
 type Method struct {
 	name     string
 	receiver reflect.Value
@@ -20,6 +21,15 @@ type Method struct {
 	errPos   int
 	hasCtx   bool
 	subPos   int
+
+	// Cost of a call used by quota
+	cost int
+
+	// Type of subscription messages declared with Payload
+	payload reflect.Type
+
+	// Additional names declared with Alias
+	aliases []string
 }
 
 // Transforms params interface coming from json parsed object to
@@ -55,7 +65,10 @@ func (m *Method) ParseArgs(params interface{}) ([]reflect.Value, error) {
 // Executes function with given parameters. If a method is subscription it passes Subscription
 // that holds write channel using Subscription.Notify().
 func (m *Method) Call(ctx context.Context, method string, args []reflect.Value, sub *Subscription) (res interface{}, errRes error) {
-	callArgs := []reflect.Value{m.receiver}
+	callArgs := []reflect.Value{}
+	if m.receiver.IsValid() {
+		callArgs = append(callArgs, m.receiver)
+	}
 	if m.hasCtx {
 		callArgs = append(callArgs, reflect.ValueOf(ctx))
 	}
@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// NameCase tells how Go method names are written in json-rpc requests
+type NameCase int
+
+const (
+	// Method names are matched ignoring case, i.e. "example.simple" and
+	// "example.Simple" both call Simple
+	CaseInsensitive NameCase = iota
+
+	// Go method name as is, i.e. "GetUser"
+	CaseExact
+
+	// Go method name in camelCase, i.e. "getUser"
+	CaseCamel
+
+	// Go method name in snake_case, i.e. "get_user"
+	CaseSnake
+)
+
+// Naming configures how method names of requests are resolved to
+// registered methods. Names consist of service, optional "subscribe" or
+// "unsubscribe" and method name joined with Separator.
+type Naming struct {
+	// Separator between parts of method name: ".", "_" or "/"
+	Separator string
+
+	// How Go method names are written by clients
+	Case NameCase
+
+	// Subscription name is sent as the first param of "service_subscribe"
+	// and "service_unsubscribe", i.e. {"method":"eth_subscribe",
+	// "params":["newHeads"]}. Names in method are still accepted.
+	SubscribeParam bool
+}
+
+// Default naming, i.e. "example.Simple" and "example.subscribe.Subscription"
+var DefaultNaming = Naming{Separator: ".", Case: CaseInsensitive}
+
+// Naming used by Ethereum clients, i.e. "eth_blockNumber" and
+// "eth_subscribe" with params ["newHeads"]
+var EthereumNaming = Naming{Separator: "_", Case: CaseCamel, SubscribeParam: true}
+
+// Method name of a request split into parts
+type methodName struct {
+	service string
+
+	// "subscribe", "unsubscribe" or empty for calls
+	action string
+
+	// Method, subscription or topic name as sent by client. Empty when
+	// subscription name is not part of method.
+	name string
+}
+
+// Checks if naming can be used
+func (n Naming) validate() error {
+	switch n.Separator {
+	case ".", "_", "/":
+	default:
+		return errors.New(`naming separator must be ".", "_" or "/"`)
+	}
+	if n.Case < CaseInsensitive || n.Case > CaseSnake {
+		return errors.New("invalid naming case")
+	}
+	return nil
+}
+
+// Returns separator, "." when it is not set
+func (n Naming) separator() string {
+	if n.Separator == "" {
+		return "."
+	}
+	return n.Separator
+}
+
+// Splits method name of a request into service, action and name. Service
+// may contain separator, i.e. "billing.invoices.list". Service of a call is
+// the longest prefix accepted by isService, or the first part when there is
+// none. Returns false when method name is invalid.
+func (n Naming) parse(method string, isService func(string) bool) (methodName, bool) {
+	sep := n.separator()
+	parts := strings.Split(method, sep)
+	if len(parts) < 2 {
+		return methodName{}, false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return methodName{}, false
+		}
+	}
+	for i := 1; i < len(parts); i++ {
+		for _, action := range []string{"subscribe", "unsubscribe"} {
+			if strings.EqualFold(parts[i], action) {
+				return methodName{service: n.join(parts[:i]...), action: action, name: n.join(parts[i+1:]...)}, true
+			}
+		}
+	}
+	split := 1
+	if isService != nil {
+		for i := len(parts) - 1; i > 1; i-- {
+			if isService(n.join(parts[:i]...)) {
+				split = i
+				break
+			}
+		}
+	}
+	return methodName{service: n.join(parts[:split]...), name: n.join(parts[split:]...)}, true
+}
+
+// Returns name of Go method as written by clients
+func (n Naming) transform(name string) string {
+	switch n.Case {
+	case CaseCamel:
+		return camelCase(name)
+	case CaseSnake:
+		return snakeCase(name)
+	}
+	return name
+}
+
+// Joins parts of method name with separator
+func (n Naming) join(parts ...string) string {
+	return strings.Join(parts, n.separator())
+}
+
+// Finds method by name sent by client. Aliases are matched exactly.
+func (n Naming) find(methods map[string]*Method, name string) *Method {
+	if n.Case == CaseInsensitive {
+		if m, ok := methods[strings.ToLower(name)]; ok {
+			return m
+		}
+	}
+	for _, m := range methods {
+		if contains(m.aliases, name) || n.Case != CaseInsensitive && n.transform(m.name) == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Converts Go name to camelCase, i.e. "GetUserID" => "getUserID" and
+// "HTTPServer" => "httpServer"
+func camelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		// Last upper case letter starts the next word
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// Converts Go name to snake_case, i.e. "GetUserID" => "get_user_id" and
+// "HTTPServer" => "http_server"
+func snakeCase(name string) string {
+	runes := []rune(name)
+	b := strings.Builder{}
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Takes subscription name from the first param when naming sends it in
+// params. Returns remaining params.
+func (n Naming) subscriptionParam(name methodName, params interface{}) (methodName, interface{}, error) {
+	if !n.SubscribeParam || name.action == "" || name.name != "" {
+		return name, params, nil
+	}
+	list, ok := params.([]interface{})
+	if !ok || len(list) == 0 {
+		return name, params, errors.New("missing subscription name in params")
+	}
+	first, ok := list[0].(string)
+	if !ok || first == "" {
+		return name, params, errors.New("subscription name must be the first param")
+	}
+	name.name = first
+	return name, list[1:], nil
+}
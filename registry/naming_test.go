@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestNamingParse(t *testing.T) {
+	services := map[string]bool{"billing.invoices": true, "billing_invoices": true}
+	isService := func(name string) bool { return services[name] }
+	tests := []struct {
+		naming Naming
+		method string
+		parsed methodName
+		ok     bool
+	}{
+		{DefaultNaming, "example.Simple", methodName{service: "example", name: "Simple"}, true},
+		{DefaultNaming, "example.subscribe.Time", methodName{service: "example", action: "subscribe", name: "Time"}, true},
+		{DefaultNaming, "example.UNSUBSCRIBE.Time", methodName{service: "example", action: "unsubscribe", name: "Time"}, true},
+		{DefaultNaming, "billing.invoices.List", methodName{service: "billing.invoices", name: "List"}, true},
+		{DefaultNaming, "billing.payments.List", methodName{service: "billing", name: "payments.List"}, true},
+		{DefaultNaming, "billing.invoices.subscribe.Created", methodName{service: "billing.invoices", action: "subscribe", name: "Created"}, true},
+		{DefaultNaming, "example", methodName{}, false},
+		{DefaultNaming, "example..Simple", methodName{}, false},
+		{EthereumNaming, "eth_blockNumber", methodName{service: "eth", name: "blockNumber"}, true},
+		{EthereumNaming, "eth_subscribe", methodName{service: "eth", action: "subscribe"}, true},
+		{EthereumNaming, "billing_invoices_list", methodName{service: "billing_invoices", name: "list"}, true},
+		{Naming{Separator: "/"}, "example/Simple", methodName{service: "example", name: "Simple"}, true},
+		{Naming{Separator: "/"}, "example.Simple", methodName{}, false},
+	}
+	for _, test := range tests {
+		parsed, ok := test.naming.parse(test.method, isService)
+		if ok != test.ok || parsed != test.parsed {
+			t.Fatalf("%s: got %+v %v, expected %+v %v", test.method, parsed, ok, test.parsed, test.ok)
+		}
+	}
+}
+
+func TestNameCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		camel string
+		snake string
+	}{
+		{"Get", "get", "get"},
+		{"GetUser", "getUser", "get_user"},
+		{"GetUserID", "getUserID", "get_user_id"},
+		{"HTTPServer", "httpServer", "http_server"},
+		{"ID", "id", "id"},
+		{"Version2Info", "version2Info", "version2_info"},
+	}
+	for _, test := range tests {
+		if got := camelCase(test.name); got != test.camel {
+			t.Fatalf("camelCase(%s) = %s, expected %s", test.name, got, test.camel)
+		}
+		if got := snakeCase(test.name); got != test.snake {
+			t.Fatalf("snakeCase(%s) = %s, expected %s", test.name, got, test.snake)
+		}
+	}
+}
+
+func TestNamingValidate(t *testing.T) {
+	valid := []Naming{DefaultNaming, EthereumNaming, {Separator: "/", Case: CaseExact}}
+	for _, n := range valid {
+		if err := n.validate(); err != nil {
+			t.Fatalf("%+v: %s", n, err)
+		}
+	}
+	invalid := []Naming{{Separator: "-"}, {Separator: ""}, {Separator: ".", Case: CaseSnake + 1}}
+	for _, n := range invalid {
+		if err := n.validate(); err == nil {
+			t.Fatalf("%+v: expected error", n)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kroksys/jrpc/openrpc"
+
+	"github.com/kroksys/jrpc/ratelimit"
+	"github.com/kroksys/jrpc/spec"
+)
+
+// Logger used to print logs when logs are turned on. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures Registry created with NewRegistry
+type Option func(*Registry) error
+
+// Turns on/off logs
+func WithLogs(logsOn bool) Option {
+	return func(reg *Registry) error {
+		reg.LogsOn = logsOn
+		return nil
+	}
+}
+
+// Sets logger used when logs are turned on. Default is log.Default().
+func WithLogger(logger Logger) Option {
+	return func(reg *Registry) error {
+		if logger == nil {
+			return errors.New("logger can not be nil")
+		}
+		reg.Logger = logger
+		return nil
+	}
+}
+
+// Sets codec used to encode subscription messages. Default is spec.DefaultCodec.
+func WithCodec(codec spec.Codec) Option {
+	return func(reg *Registry) error {
+		if codec == nil {
+			return errors.New("codec can not be nil")
+		}
+		reg.Codec = codec
+		return nil
+	}
+}
+
+// Sets title and version of the api returned by "rpc.Discover"
+func WithInfo(title, version string) Option {
+	return func(reg *Registry) error {
+		reg.Info = openrpc.Info{Title: title, Version: version}
+		return nil
+	}
+}
+
+// Sets rate limiter checked before every call
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(reg *Registry) error {
+		reg.RateLimiter = limiter
+		return nil
+	}
+}
+
+// Sets quota limiting total cost of calls per principal, or per connection
+// when principal is not set
+func WithQuota(quota ratelimit.Quota) Option {
+	return func(reg *Registry) error {
+		if quota.Limit <= 0 || quota.Window <= 0 {
+			return errors.New("quota limit and window must be positive")
+		}
+		reg.Quota = ratelimit.NewQuotaTracker(quota)
+		return nil
+	}
+}
+
+// Sets how method names of requests are resolved. Default is DefaultNaming.
+/*
+	reg, err := registry.NewRegistry(registry.WithNaming(registry.EthereumNaming))
+*/
+func WithNaming(naming Naming) Option {
+	return func(reg *Registry) error {
+		if err := naming.validate(); err != nil {
+			return err
+		}
+		reg.Naming = naming
+		return nil
+	}
+}
+
+// Sets router resolving method names of requests. Default is DefaultRouter.
+func WithRouter(router Router) Option {
+	return func(reg *Registry) error {
+		if router == nil {
+			return errors.New("router can not be nil")
+		}
+		reg.Router = router
+		return nil
+	}
+}
+
+// RegisterOption configures service registered with Registry.Register
+type RegisterOption func(*registerConfig)
+
+// Settings of a single service registration
+type registerConfig struct {
+	costs    map[string]int
+	payloads map[string]reflect.Type
+	aliases  map[string][]string
+
+	// Lowercase names of excluded methods
+	exclude map[string]bool
+
+	// Rules excluding methods by name
+	excludeFuncs []func(name string) bool
+}
+
+// Creates registration settings and applies options
+func newRegisterConfig(opts []RegisterOption) registerConfig {
+	config := registerConfig{
+		costs:    map[string]int{},
+		payloads: map[string]reflect.Type{},
+		aliases:  map[string][]string{},
+		exclude:  map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// Applies registration options to extracted methods. Owner describes
+// registered service or function in errors.
+func (c registerConfig) apply(methods, subscriptions map[string]*Method, owner string) error {
+	for method, payload := range c.payloads {
+		fn, ok := subscriptions[method]
+		if !ok {
+			return fmt.Errorf("payload declared for missing subscription %s of %s", method, owner)
+		}
+		fn.payload = payload
+	}
+	for method, aliases := range c.aliases {
+		fn, ok := methods[method]
+		if !ok {
+			fn, ok = subscriptions[method]
+		}
+		if !ok {
+			return fmt.Errorf("alias declared for missing method %s of %s", method, owner)
+		}
+		fn.aliases = append(fn.aliases, aliases...)
+	}
+	for method, cost := range c.costs {
+		fn, ok := methods[method]
+		if !ok {
+			fn, ok = subscriptions[method]
+		}
+		if !ok {
+			return fmt.Errorf("cost declared for missing method %s of %s", method, owner)
+		}
+		fn.cost = cost
+	}
+	return nil
+}
+
+// Checks if method is excluded by name or rule
+func (c registerConfig) excluded(name string) bool {
+	if c.exclude[strings.ToLower(name)] {
+		return true
+	}
+	for _, rule := range c.excludeFuncs {
+		if rule(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Declares cost of a method used by quota. Methods cost 1 by default and
+// cost 0 does not use quota.
+func Cost(method string, cost int) RegisterOption {
+	return func(c *registerConfig) {
+		c.costs[strings.ToLower(method)] = cost
+	}
+}
+
+// Declares type of messages sent by subscription method with
+// Subscription.Notify. It is used in OpenRPC document and generated clients.
+/*
+	reg.Register("example", Example{}, registry.Payload("Time", time.Time{}))
+*/
+func Payload(subscription string, v interface{}) RegisterOption {
+	return func(c *registerConfig) {
+		c.payloads[strings.ToLower(subscription)] = reflect.TypeOf(v)
+	}
+}
+
+// Declares additional name of a method or subscription matched exactly as
+// sent by clients, regardless of naming case.
+/*
+	reg.Register("eth", Eth{}, registry.Alias("ChainID", "chainId"))
+*/
+func Alias(method string, name string) RegisterOption {
+	return func(c *registerConfig) {
+		method = strings.ToLower(method)
+		c.aliases[method] = append(c.aliases[method], name)
+	}
+}
+
+// Excludes methods of a service from registration, i.e. exported helpers
+// that are not meant to be called by clients
+/*
+	reg.Register("report", &Report{}, registry.Exclude("SetStore", "Close"))
+*/
+func Exclude(methods ...string) RegisterOption {
+	return func(c *registerConfig) {
+		for _, method := range methods {
+			c.exclude[strings.ToLower(method)] = true
+		}
+	}
+}
+
+// Excludes methods of a service for which rule returns true
+/*
+	reg.Register("report", &Report{}, registry.ExcludeFunc(func(name string) bool {
+		return strings.HasPrefix(name, "Internal")
+	}))
+*/
+func ExcludeFunc(rule func(name string) bool) RegisterOption {
+	return func(c *registerConfig) {
+		c.excludeFuncs = append(c.excludeFuncs, rule)
+	}
+}
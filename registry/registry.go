@@ -2,11 +2,16 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"reflect"
 	"strings"
 
 	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/openrpc"
+	"github.com/kroksys/jrpc/ratelimit"
 	"github.com/kroksys/jrpc/spec"
 	"github.com/kroksys/pool"
 )
@@ -23,21 +28,76 @@ type Registry struct {
 	// Flag to turn on/off logs for server
 	LogsOn bool
 
+	// Logger used when logs are turned on
+	Logger Logger
+
+	// Codec used to encode subscription messages
+	Codec spec.Codec
+
+	// Rate limiter checked before every call. Nil means no limits.
+	RateLimiter *ratelimit.Limiter
+
+	// Tracks cost of calls per principal or connection. Nil means no quota.
+	Quota *ratelimit.QuotaTracker
+
+	// Title and version of the api returned by "rpc.Discover"
+	Info openrpc.Info
+
+	// How method names of requests are resolved by DefaultRouter
+	Naming Naming
+
+	// Resolves method names of requests. Nil means DefaultRouter.
+	Router Router
+
 	// Registered services
 	services *pool.PoolStr[Service]
 
 	// Holds active subscriptions.
 	// Subscription[key] - key = conn.Conn.ID + subscription.methodName
 	subscriptions *pool.PoolStr[*Subscription]
+
+	// Number of active subscriptions per connection ID. Guarded by the
+	// lock of subscriptions.
+	connSubscriptions map[string]int
+
+	// Registered topics published from the server.
+	// Topic[key] - key = service + "." + lowercase topic name
+	topics *pool.PoolStr[*Topic]
+}
+
+// Creates new Registry with initialised services map and applies options
+func NewRegistry(opts ...Option) (*Registry, error) {
+	reg := &Registry{
+		services:          pool.NewPoolStr[Service](),
+		subscriptions:     pool.NewPoolStr[*Subscription](),
+		connSubscriptions: make(map[string]int),
+		topics:            pool.NewPoolStr[*Topic](),
+		Logger:            log.Default(),
+		Codec:             spec.DefaultCodec,
+		Info:              openrpc.Info{Title: "jrpc", Version: "0.0.0"},
+		Naming:            DefaultNaming,
+	}
+	for _, opt := range opts {
+		if err := opt(reg); err != nil {
+			return nil, err
+		}
+	}
+	if err := reg.Register(BuiltinService, builtin{reg: reg}, Cost("Quota", 0), Cost("Discover", 0)); err != nil {
+		return nil, err
+	}
+	return reg, nil
 }
 
-// Creates new Registry with initialised services map
-func NewRegistry(logsOn bool) *Registry {
-	return &Registry{
-		services:      pool.NewPoolStr[Service](),
-		subscriptions: pool.NewPoolStr[*Subscription](),
-		LogsOn:        logsOn,
+// Creates new Registry with logs turned on or off. Kept for callers of the
+// former NewRegistry(logsOn bool). Only the builtin service is registered
+// with default settings, so it does not return error and panics if
+// NewRegistry ever fails with them.
+func NewRegistryWithLogs(logsOn bool) *Registry {
+	reg, err := NewRegistry(WithLogs(logsOn))
+	if err != nil {
+		panic(err)
 	}
+	return reg
 }
 
 // Call a method based on json-rpc Request. If a request is notification
@@ -45,146 +105,435 @@ func NewRegistry(logsOn bool) *Registry {
 // Returns response and ShouldReply flag.
 func (reg *Registry) Call(ctx context.Context, req spec.Request, c *conn.Conn) spec.Response {
 	result := spec.NewResponse(req.ID, nil)
-	split := strings.Split(req.Method, ".")
-	if len(split) != 2 && len(split) != 3 {
-		result.Error = spec.NewError(spec.MethodNotFoundCode, "invalid method name")
+	res, err := reg.dispatch(ctx, req.Method, req.ID, req.Params, c)
+	if err != nil {
+		result.Error = err
 		return result
 	}
-	serviceName, methodName := split[0], strings.ToLower(split[1])
-	var fn *Method
+	result.Result = res
+	return result
+}
+
+// Executes json-rpc Notification. Subscribes, unsubscribes or calls a
+// method without returning its result. Returned error is sent to the client
+// only when method can not be resolved or subscription fails.
+func (reg *Registry) Subscribe(ctx context.Context, req spec.Notification, c *conn.Conn) *spec.Error {
+	_, err := reg.dispatch(ctx, req.Method, nil, req.Params, c)
+	return err
+}
+
+// Resolves method with router and executes it. ID is nil for notifications,
+// results and errors of called methods are not returned for them.
+func (reg *Registry) dispatch(ctx context.Context, method string, id interface{}, params interface{}, c *conn.Conn) (interface{}, *spec.Error) {
+	ctx = WithConn(ctx, c)
+	route, err := reg.router().Route(reg, method, params)
+	if err == nil && route.Method == nil && route.Topic == nil {
+		err = spec.NewError(spec.MethodNotFoundCode, fmt.Sprintf("missing method %s", method))
+	}
+	if err != nil {
+		// Unresolved methods still count towards global and connection limits
+		if limitErr := reg.checkRateLimit("", c); limitErr != nil {
+			return nil, limitErr
+		}
+		return nil, err
+	}
+	if err := reg.checkRateLimit(route.name(), c); err != nil {
+		return nil, err
+	}
+	if route.Topic != nil {
+		return reg.subscribeTopic(route.Topic, route.Kind, id, route.Params, c)
+	}
+
+	fn := route.Method
 	var sub *Subscription
-	if methodName == "subscribe" || methodName == "unsubscribe" {
-		if len(split) == 3 {
-			fn = reg.FindSubscription(serviceName, strings.ToLower(split[2]))
-		} else {
-			fn = reg.FindSubscription(serviceName)
+	switch route.Kind {
+	case RouteSubscribe:
+		if _, ok := reg.subscriptions.GetOk(c.ID + fn.name); ok {
+			return nil, spec.NewError(spec.InternalErrorCode, "already subscribed")
 		}
-		if fn == nil {
-			result.Error = spec.NewError(spec.InternalErrorCode, "invalid subscription name")
-			return result
+	case RouteUnsubscribe:
+		active, ok := reg.subscriptions.GetOk(c.ID + fn.name)
+		if !ok {
+			return nil, spec.NewError(spec.InternalErrorCode, "not subscribed")
 		}
-		var ok bool
-		sub, ok = reg.subscriptions.GetOk(c.ID + fn.name)
-		if methodName == "subscribe" {
-			if ok {
-				result.Error = spec.NewError(spec.InternalErrorCode, "already subscribed")
-				return result
-			}
-			sub = NewSubscription(fn.name, req.ID, c, reg.LogsOn)
-			reg.subscriptions.Put(sub.ID(), sub)
-			defer reg.subscriptions.Delete(sub.ID())
-		} else {
-			if !ok {
-				result.Error = spec.NewError(spec.InternalErrorCode, "not subscribed")
-				return result
-			}
-			sub.Close()
-			reg.subscriptions.Delete(sub.ID())
-			result.Result = spec.NewResponse(req.ID, "unsubscribed")
-			return result
+		active.Close()
+		reg.removeSubscription(active)
+		return spec.NewResponse(id, "unsubscribed"), nil
+	}
+	if err := reg.useQuota(fn, c); err != nil {
+		return nil, err
+	}
+	if route.Kind == RouteSubscribe {
+		sub = reg.newSubscription(fn.name, id, c)
+		sub.service = route.Service
+		reg.putSubscription(sub)
+		defer reg.removeSubscription(sub)
+	}
+
+	args, parseErr := fn.ParseArgs(route.Params)
+	if parseErr != nil {
+		return nil, spec.NewError(spec.InvalidParamsCode, parseErr.Error())
+	}
+	res, callErr := fn.Call(ctx, fn.name, args, sub)
+	if id == nil && route.Kind == RouteCall {
+		// Notification calls are not answered, errors are only logged
+		if callErr != nil && reg.LogsOn {
+			reg.Logger.Printf("Notification:%s error: %s\n", method, callErr.Error())
 		}
-	} else { // Method
-		fn = reg.FindMethod(serviceName, methodName)
+		return nil, nil
 	}
-	if fn == nil {
-		result.Error = spec.NewError(spec.MethodNotFoundCode,
-			fmt.Sprintf("missing services %s method %s", serviceName, methodName))
-		return result
+	if callErr != nil {
+		return nil, spec.NewError(spec.InternalErrorCode, callErr.Error())
 	}
-	args, err := fn.ParseArgs(req.Params)
+	return res, nil
+}
+
+// Returns router resolving method names
+func (reg *Registry) router() Router {
+	if reg.Router == nil {
+		return DefaultRouter{}
+	}
+	return reg.Router
+}
+
+// Checks rate limits for the method called by connection. Method is the
+// canonical name of resolved route, so aliases and naming variants share
+// per method limits. Returns error with seconds to wait before retrying
+// when the call is limited.
+func (reg *Registry) checkRateLimit(method string, c *conn.Conn) *spec.Error {
+	if reg.RateLimiter == nil {
+		return nil
+	}
+	wait, ok := reg.RateLimiter.Allow(c.ID, c.Principal(), method)
+	if ok {
+		return nil
+	}
+	return spec.NewError(spec.RateLimitedCode, spec.RateLimitedData{
+		RetryAfter: math.Ceil(wait.Seconds()*1000) / 1000,
+	})
+}
+
+// Uses method cost from the quota of connection principal, or connection
+// when principal is not set. Returns error when quota is exceeded.
+func (reg *Registry) useQuota(fn *Method, c *conn.Conn) *spec.Error {
+	if reg.Quota == nil || fn.cost <= 0 {
+		return nil
+	}
+	remaining, reset, ok := reg.Quota.Use(quotaKey(c), fn.cost)
+	if ok {
+		return nil
+	}
+	return spec.NewError(spec.QuotaExceededCode, spec.QuotaExceededData{
+		Cost:       fn.cost,
+		Remaining:  remaining,
+		ResetAfter: math.Ceil(reset.Seconds()*1000) / 1000,
+	})
+}
+
+// Register struct methods in registry. This should be called when server is
+// initialised. Returns error when service with the same name is already
+// registered.
+// Methods with value receivers are exposed for both struct and pointer to
+// struct, methods with pointer receivers only when a pointer is registered.
+// Returns error describing exported methods with unsupported signatures
+// unless they are excluded with Exclude or ExcludeFunc.
+// Options can declare cost of methods used by quota and type of messages
+// sent by subscriptions.
+/*
+	reg.Register("report", Report{}, registry.Cost("Generate", 10))
+*/
+func (reg *Registry) Register(name string, service interface{}, opts ...RegisterOption) error {
+	_, err := reg.RegisterWithReport(name, service, opts...)
+	return err
+}
+
+// Registers service the same way as Register and returns report of exposed
+// and excluded methods.
+/*
+	report, err := reg.RegisterWithReport("example", &Example{})
 	if err != nil {
-		result.Error = spec.NewError(spec.InvalidParamsCode, err.Error())
-		return result
+		return err
 	}
-	callResponse, err := fn.Call(ctx, methodName, args, sub)
+	log.Println(report)
+*/
+func (reg *Registry) RegisterWithReport(name string, service interface{}, opts ...RegisterOption) (*Report, error) {
+	s, skipped, err := reg.newService(name, service, opts)
 	if err != nil {
-		result.Error = spec.NewError(spec.InternalErrorCode, err.Error())
-		return result
+		return nil, err
 	}
-	result.Result = callResponse
-	return result
+	reg.services.Lock()
+	defer reg.services.Unlock()
+	if _, ok := reg.services.Data()[name]; ok {
+		return nil, fmt.Errorf("service %s is already registered", name)
+	}
+	reg.services.Data()[name] = s
+	return &Report{Service: name, Exposed: reg.serviceMethods(s), Skipped: skipped}, nil
 }
 
-// Notify a method based on json-rpc Request. If a request is notification
-// a Notification struct will be initialised and write channel attached to it.
-func (reg *Registry) Subscribe(ctx context.Context, req spec.Notification, c *conn.Conn) *spec.Error {
-	split := strings.Split(req.Method, ".")
-	if len(split) != 2 && len(split) != 3 {
-		return spec.NewError(spec.MethodNotFoundCode, "invalid method name")
+// Replaces implementation of a registered service. New calls use the new
+// implementation while active subscriptions keep running on the old one
+// until they end. Functions added with RegisterFunc are kept, it is an error
+// when the new implementation has a method with the same name.
+/*
+	if rollout.Enabled("reports-v2") {
+		err = reg.Replace("report", ReportV2{})
 	}
-	serviceName, methodName := split[0], strings.ToLower(split[1])
-	if methodName != "subscribe" && methodName != "unsubscribe" {
-		return spec.NewError(spec.MethodNotFoundCode, "notifications can be used only to subscribe or unsubscribe")
+*/
+func (reg *Registry) Replace(name string, service interface{}, opts ...RegisterOption) error {
+	s, _, err := reg.newService(name, service, opts)
+	if err != nil {
+		return err
 	}
-
-	var fn *Method
-	if len(split) == 3 {
-		fn = reg.FindSubscription(serviceName, strings.ToLower(split[2]))
-	} else {
-		fn = reg.FindSubscription(serviceName)
+	reg.services.Lock()
+	defer reg.services.Unlock()
+	old, ok := reg.services.Data()[name]
+	if !ok {
+		return fmt.Errorf("service %s is not registered", name)
 	}
-	if fn == nil {
-		return spec.NewError(spec.MethodNotFoundCode,
-			fmt.Sprintf("missing subscription %s", req.Method))
+	if err := s.keepFuncs(old); err != nil {
+		return err
 	}
+	reg.services.Data()[name] = s
+	return nil
+}
 
-	sub, ok := reg.subscriptions.GetOk(c.ID + fn.name)
-	switch methodName {
-	case "subscribe":
-		if ok {
-			return spec.NewError(spec.InternalErrorCode, "already subscribled")
-		}
-		sub = NewSubscription(fn.name, nil, c, reg.LogsOn)
-		reg.subscriptions.Put(sub.ID(), sub)
-		defer reg.subscriptions.Delete(sub.ID())
-	case "unsubscribe":
-		if !ok {
-			return spec.NewError(spec.InternalErrorCode, "not subscribled")
+// Removes service so new calls of its methods return method not found
+// error. Calls already running are finished. Active subscriptions of the
+// service, including ones started before Replace, are closed when
+// closeSubscriptions is set, otherwise they run until unsubscribed.
+func (reg *Registry) Unregister(name string, closeSubscriptions bool) error {
+	reg.services.Lock()
+	_, ok := reg.services.Data()[name]
+	delete(reg.services.Data(), name)
+	reg.services.Unlock()
+	if !ok {
+		return fmt.Errorf("service %s is not registered", name)
+	}
+	if !closeSubscriptions {
+		return nil
+	}
+	active := []*Subscription{}
+	reg.subscriptions.Each(func(sub *Subscription) {
+		if sub.service == name {
+			active = append(active, sub)
 		}
+	})
+	for _, sub := range active {
 		sub.Close()
-		reg.subscriptions.Delete(sub.ID())
-		return nil
 	}
+	return nil
+}
 
-	args, err := fn.ParseArgs(req.Params)
+// Creates service from struct methods and applies registration options.
+// Returns exported methods excluded by options.
+func (reg *Registry) newService(name string, service interface{}, opts []RegisterOption) (Service, []SkippedMethod, error) {
+	v := reflect.ValueOf(service)
+	if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return Service{}, nil, fmt.Errorf("service %s is nil", name)
+	}
+	config := newRegisterConfig(opts)
+	methods, subscriptions, skipped, err := reg.extractMethods(v, config.excluded)
 	if err != nil {
-		return spec.NewError(spec.InvalidParamsCode, err.Error())
+		return Service{}, nil, fmt.Errorf("service %T: %w", service, err)
+	}
+	if len(methods)+len(subscriptions) == 0 {
+		return Service{}, nil, fmt.Errorf("service %T doesn't have methods to expose", service)
 	}
+	if err := config.apply(methods, subscriptions, fmt.Sprintf("service %T", service)); err != nil {
+		return Service{}, nil, err
+	}
+	return Service{
+		Name:          name,
+		methods:       methods,
+		subscriptions: subscriptions,
+	}, skipped, nil
+}
 
-	_, err = fn.Call(ctx, methodName, args, sub)
+// Register a function or closure as a method of a service, i.e.
+// "math.add". Arguments and results follow the same rules as methods of
+// registered structs and a function taking *Subscription is registered as
+// a subscription. Functions can be added to a service registered with
+// Register. Options refer to the function by its name after the service.
+/*
+	reg.RegisterFunc("math.add", func(ctx context.Context, a, b int) (int, error) {
+		return a + b, nil
+	}, registry.Cost("add", 2))
+*/
+func (reg *Registry) RegisterFunc(name string, fn interface{}, opts ...RegisterOption) error {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return fmt.Errorf("invalid function name %s, expected service.method", name)
+	}
+	serviceName, methodName := name[:i], name[i+1:]
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("%s must be a function, got %T", name, fn)
+	}
+	meth, err := reg.newMethod(methodName, reflect.Value{}, v)
 	if err != nil {
-		return spec.NewError(spec.InternalErrorCode, err.Error())
+		return fmt.Errorf("function %s: %w", name, err)
+	}
+	key := strings.ToLower(methodName)
+	methods, subscriptions := map[string]*Method{}, map[string]*Method{}
+	if meth.subPos != -1 {
+		subscriptions[key] = meth
+	} else {
+		methods[key] = meth
 	}
+	if err := newRegisterConfig(opts).apply(methods, subscriptions, "function "+name); err != nil {
+		return err
+	}
+
+	reg.services.Lock()
+	defer reg.services.Unlock()
+	s, ok := reg.services.Data()[serviceName]
+	if !ok {
+		s = Service{Name: serviceName}
+	}
+	if s.methods[key] != nil || s.subscriptions[key] != nil {
+		return fmt.Errorf("method %s is already registered", name)
+	}
+	// Maps are copied because registered ones are read without lock
+	s.methods = mergeMethods(s.methods, methods)
+	s.subscriptions = mergeMethods(s.subscriptions, subscriptions)
+	reg.services.Data()[serviceName] = s
 	return nil
 }
 
-// Register struct methods in registry. This should be called when server is
-// initialised.
-func (reg *Registry) Register(name string, service interface{}) error {
-	methods, subscriptions := reg.extractMethods(reflect.ValueOf(service))
-	if len(methods)+len(subscriptions) == 0 {
-		return fmt.Errorf("service %T doesn't have methods to expose", service)
+// Register a topic that can be published from the server using Publish.
+// Topic name consists of service and topic separated by a dot (i.e.
+// "orders.updates") and clients subscribe to it with "orders.subscribe.updates".
+// Service may be a nested namespace, i.e. "billing.invoices.created".
+// Filter is optional and is called for each subscription on Publish.
+func (reg *Registry) RegisterTopic(name string, filter TopicFilter) error {
+	key, ok := topicKey(name)
+	if !ok {
+		return fmt.Errorf("invalid topic name %s, expected service.topic", name)
 	}
-
-	if _, ok := reg.services.GetOk(name); !ok {
-		reg.services.Put(name, Service{
-			Name:          name,
-			methods:       methods,
-			subscriptions: subscriptions,
-		})
+	if _, ok := reg.topics.GetOk(key); ok {
+		return fmt.Errorf("topic %s is already registered", name)
 	}
+	reg.topics.Put(key, NewTopic(key, filter))
 	return nil
 }
 
-// Finds method in registry
+// Publish payload to all subscriptions of a topic across connections.
+// Returns number of subscriptions that received the payload.
+func (reg *Registry) Publish(name string, payload interface{}) (int, error) {
+	key, _ := topicKey(name)
+	topic, ok := reg.topics.GetOk(key)
+	if !ok {
+		return 0, fmt.Errorf("missing topic %s", name)
+	}
+	return topic.publish(payload), nil
+}
+
+// Finds topic in registry
+func (reg *Registry) FindTopic(service, name string) *Topic {
+	return reg.topics.Get(service + "." + strings.ToLower(name))
+}
+
+// Finds topic subscribed with method name, i.e. "service.subscribe.topic"
+func (reg *Registry) findTopic(name methodName) *Topic {
+	if name.name == "" {
+		return nil
+	}
+	return reg.FindTopic(name.service, name.name)
+}
+
+// Subscribes or unsubscribes connection to a topic. Unlike subscription
+// methods it does not block. Subscription lives until "unsubscribe" is called
+// or connection is closed.
+func (reg *Registry) subscribeTopic(topic *Topic, kind RouteKind, id interface{}, params interface{}, c *conn.Conn) (interface{}, *spec.Error) {
+	sub, ok := reg.subscriptions.GetOk(c.ID + topic.Name)
+	if kind == RouteUnsubscribe {
+		if !ok {
+			return nil, spec.NewError(spec.InternalErrorCode, "not subscribed")
+		}
+		sub.Close()
+		reg.removeSubscription(sub)
+		removeSubscription(topic.subscriptions, sub)
+		return "unsubscribed", nil
+	}
+	if ok {
+		return nil, spec.NewError(spec.InternalErrorCode, "already subscribed")
+	}
+	sub = reg.newSubscription(topic.Name, id, c)
+	sub.Params = params
+	reg.putSubscription(sub)
+	topic.subscriptions.Put(sub.ID(), sub)
+	go func() {
+		select {
+		case <-sub.Exit:
+		case <-c.Exit:
+			sub.Close()
+		}
+		reg.removeSubscription(sub)
+		removeSubscription(topic.subscriptions, sub)
+	}()
+	return "subscribed", nil
+}
+
+// Checks if connection has any active subscription
+func (reg *Registry) HasSubscriptions(connID string) bool {
+	reg.subscriptions.Lock()
+	defer reg.subscriptions.Unlock()
+	return reg.connSubscriptions[connID] > 0
+}
+
+// Adds active subscription and counts it for its connection
+func (reg *Registry) putSubscription(sub *Subscription) {
+	reg.subscriptions.Lock()
+	defer reg.subscriptions.Unlock()
+	if old, ok := reg.subscriptions.Data()[sub.ID()]; ok {
+		reg.uncount(old)
+	}
+	reg.subscriptions.Data()[sub.ID()] = sub
+	reg.connSubscriptions[sub.Conn.ID]++
+}
+
+// Removes subscription only if it was not replaced by a newer one
+func (reg *Registry) removeSubscription(sub *Subscription) {
+	reg.subscriptions.Lock()
+	defer reg.subscriptions.Unlock()
+	if reg.subscriptions.Data()[sub.ID()] == sub {
+		delete(reg.subscriptions.Data(), sub.ID())
+		reg.uncount(sub)
+	}
+}
+
+// Decreases subscription count of connection. Must hold subscriptions lock.
+func (reg *Registry) uncount(sub *Subscription) {
+	if reg.connSubscriptions[sub.Conn.ID]--; reg.connSubscriptions[sub.Conn.ID] <= 0 {
+		delete(reg.connSubscriptions, sub.Conn.ID)
+	}
+}
+
+// Creates new Subscription using registry logger and codec
+func (reg *Registry) newSubscription(methodName string, id interface{}, c *conn.Conn) *Subscription {
+	sub := NewSubscription(methodName, id, c, reg.LogsOn)
+	sub.logger = reg.Logger
+	sub.codec = reg.Codec
+	return sub
+}
+
+// Finds method in registry by lowercase name. Returns nil when service or
+// method is missing.
 func (reg *Registry) FindMethod(service, name string) *Method {
-	return reg.services.Get(service).methods[name]
+	s, ok := reg.services.GetOk(service)
+	if !ok {
+		return nil
+	}
+	return s.methods[name]
 }
 
 // Finds subscription in registry. Subscription in this case is just a method
 // that can be called.
 func (reg *Registry) FindSubscription(service string, name ...string) *Method {
-	s := reg.services.Get(service)
+	s, ok := reg.services.GetOk(service)
+	if !ok {
+		return nil
+	}
 	if len(name) == 1 {
 		return s.subscriptions[name[0]]
 	}
@@ -197,59 +546,160 @@ func (reg *Registry) FindSubscription(service string, name ...string) *Method {
 	return nil
 }
 
+// Checks if service is registered
+func (reg *Registry) hasService(name string) bool {
+	_, ok := reg.services.GetOk(name)
+	return ok
+}
+
+// Finds method called with method name according to naming
+func (reg *Registry) findMethod(name methodName) *Method {
+	s, ok := reg.services.GetOk(name.service)
+	if !ok {
+		return nil
+	}
+	return reg.Naming.find(s.methods, name.name)
+}
+
+// Finds subscription called with method name according to naming. When
+// name is not set service must have a single subscription.
+func (reg *Registry) findSubscription(name methodName) *Method {
+	s, ok := reg.services.GetOk(name.service)
+	if !ok {
+		return nil
+	}
+	if name.name != "" {
+		return reg.Naming.find(s.subscriptions, name.name)
+	}
+	if len(s.subscriptions) != 1 {
+		return nil
+	}
+	for k := range s.subscriptions {
+		return s.subscriptions[k]
+	}
+	return nil
+}
+
 // Extract functions/methods and subscriptions out of struct based on input and
-// output parameters.
-func (reg *Registry) extractMethods(theStruct reflect.Value) (map[string]*Method, map[string]*Method) {
+// output parameters. Methods with pointer receivers are extracted only when
+// a pointer is registered, otherwise they would change a copy of the value.
+// Returns exported methods skipped by exclude or because of pointer receiver
+// and error describing methods with unsupported signatures.
+func (reg *Registry) extractMethods(theStruct reflect.Value, exclude func(name string) bool) (map[string]*Method, map[string]*Method, []SkippedMethod, error) {
 	methods := make(map[string]*Method)
 	subscriptions := make(map[string]*Method)
+	skipped := []SkippedMethod{}
+	invalid := []string{}
 	structType := theStruct.Type()
-	for i := 0; i < structType.NumMethod(); i++ {
-		m := structType.Method(i)
+	ptrType := structType
+	if structType.Kind() != reflect.Ptr {
+		ptrType = reflect.PtrTo(structType)
+	}
+	for i := 0; i < ptrType.NumMethod(); i++ {
+		m := ptrType.Method(i)
 		if m.PkgPath != "" { // not exported
 			continue
 		}
-		fntype := m.Func.Type()
-		// Arguments
-		args := []reflect.Type{}
-		hasCtx := false
-		subPos := -1
-		for j := 1; j < fntype.NumIn(); j++ {
-			if j == 1 && fntype.In(j) == contextType {
-				hasCtx = true
-				continue
-			}
-			if fntype.In(j) == subscriptionType {
-				subPos = j
-				continue
-			}
-			args = append(args, fntype.In(j))
-		}
-		// Returns
-		errPos := -1
-		if fntype.NumOut() > 2 {
+		if exclude(m.Name) {
+			skipped = append(skipped, SkippedMethod{Name: m.Name, Reason: "excluded"})
 			continue
 		}
-		for j := 0; j < fntype.NumOut(); j++ {
-			if reg.isErrorType(fntype.Out(j)) {
-				errPos = j
+		if ptrType != structType {
+			if valueMethod, ok := structType.MethodByName(m.Name); ok {
+				m = valueMethod
+			} else {
+				skipped = append(skipped, SkippedMethod{Name: m.Name, Reason: "has pointer receiver, register a pointer to expose it"})
+				if reg.LogsOn {
+					reg.Logger.Printf("Warning: %s.%s has pointer receiver and is not exposed, register a pointer\n", structType, m.Name)
+				}
+				continue
 			}
 		}
-		meth := &Method{
-			name:     m.Name,
-			receiver: theStruct,
-			fn:       m.Func,
-			args:     args,
-			errPos:   errPos,
-			hasCtx:   hasCtx,
-			subPos:   subPos,
+		meth, err := reg.newMethod(m.Name, theStruct, m.Func)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("method %s %s", m.Name, err))
+			continue
 		}
-		if subPos != -1 {
+		if meth.subPos != -1 {
 			subscriptions[strings.ToLower(m.Name)] = meth
 		} else {
 			methods[strings.ToLower(m.Name)] = meth
 		}
 	}
-	return methods, subscriptions
+	if len(invalid) > 0 {
+		return nil, nil, nil, fmt.Errorf("unsupported methods (exclude them with registry.Exclude): %s", strings.Join(invalid, "; "))
+	}
+	return methods, subscriptions, skipped, nil
+}
+
+// Creates Method from function based on its input and output parameters.
+// Receiver is the first input of struct methods and is not valid for plain
+// functions. Context can only be the first argument and *Subscription the
+// first argument after optional context. Results are none, a single value or
+// error, or value and error. Returns error describing unsupported signature.
+func (reg *Registry) newMethod(name string, receiver reflect.Value, fn reflect.Value) (*Method, error) {
+	fntype := fn.Type()
+	first := 0
+	if receiver.IsValid() {
+		first = 1
+	}
+	if fntype.IsVariadic() {
+		return nil, errors.New("has variadic arguments")
+	}
+	// Arguments
+	args := []reflect.Type{}
+	hasCtx := false
+	subPos := -1
+	for j := first; j < fntype.NumIn(); j++ {
+		in := fntype.In(j)
+		switch {
+		case in == contextType:
+			if j != first {
+				return nil, errors.New("has context.Context that is not the first argument")
+			}
+			hasCtx = true
+		case in == subscriptionType:
+			if subPos != -1 || len(args) > 0 {
+				return nil, errors.New("has *Subscription that is not the first argument after optional context.Context")
+			}
+			subPos = j
+		case in == subscriptionType.Elem():
+			return nil, errors.New("takes Subscription by value, expected *Subscription")
+		case in.Kind() == reflect.Chan || in.Kind() == reflect.Func || in.Kind() == reflect.UnsafePointer:
+			return nil, fmt.Errorf("has argument of type %s that can not be decoded from json", in)
+		default:
+			args = append(args, in)
+		}
+	}
+	// Returns
+	errPos := -1
+	switch fntype.NumOut() {
+	case 0:
+	case 1:
+		if reg.isErrorType(fntype.Out(0)) {
+			errPos = 0
+		}
+	case 2:
+		if reg.isErrorType(fntype.Out(0)) && reg.isErrorType(fntype.Out(1)) {
+			return nil, errors.New("returns two errors, expected result and error")
+		}
+		if !reg.isErrorType(fntype.Out(1)) {
+			return nil, fmt.Errorf("returns %s as the second result, expected error", fntype.Out(1))
+		}
+		errPos = 1
+	default:
+		return nil, fmt.Errorf("has %d results, expected at most result and error", fntype.NumOut())
+	}
+	return &Method{
+		name:     name,
+		receiver: receiver,
+		fn:       fn,
+		args:     args,
+		errPos:   errPos,
+		hasCtx:   hasCtx,
+		subPos:   subPos,
+		cost:     1,
+	}, nil
 }
 
 // Checks if type is an error
@@ -259,3 +709,57 @@ func (*Registry) isErrorType(t reflect.Type) bool {
 	}
 	return t.Implements(errorType)
 }
+
+// Checks if method name is a subscribe or unsubscribe call using
+// DefaultNaming, i.e. "service.subscribe" or "service.unsubscribe.name".
+// Such calls block while subscription is running.
+func IsSubscriptionMethod(method string) bool {
+	name, ok := DefaultNaming.parse(method, nil)
+	return ok && name.action != ""
+}
+
+// Checks if request is a subscribe or unsubscribe call resolved by registry
+// router
+func (reg *Registry) IsSubscriptionRequest(req spec.Request) bool {
+	route, err := reg.router().Route(reg, req.Method, req.Params)
+	return err == nil && route.Kind != RouteCall
+}
+
+// Key used to track quota: principal or connection ID
+func quotaKey(c *conn.Conn) string {
+	if principal := c.Principal(); principal != "" {
+		return "principal:" + principal
+	}
+	return "conn:" + c.ID
+}
+
+// Converts topic name "service.Topic" to the key "service.topic". Service
+// may be a nested namespace, i.e. "billing.invoices.Created".
+func topicKey(name string) (string, bool) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", false
+	}
+	return name[:i] + "." + strings.ToLower(name[i+1:]), true
+}
+
+// Returns new map with methods of both maps
+func mergeMethods(a, b map[string]*Method) map[string]*Method {
+	result := make(map[string]*Method, len(a)+len(b))
+	for k, m := range a {
+		result[k] = m
+	}
+	for k, m := range b {
+		result[k] = m
+	}
+	return result
+}
+
+// Removes subscription from pool only if it was not replaced by a newer one
+func removeSubscription(p *pool.PoolStr[*Subscription], sub *Subscription) {
+	p.Lock()
+	defer p.Unlock()
+	if p.Data()[sub.ID()] == sub {
+		delete(p.Data(), sub.ID())
+	}
+}
@@ -0,0 +1,354 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/ratelimit"
+	"github.com/kroksys/jrpc/spec"
+)
+
+type Reports struct{}
+
+func (Reports) Generate() string {
+	return "report"
+}
+
+// Connection served by nobody, enough to call registry directly
+func testConn(t *testing.T) *conn.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	c := conn.NewConn(server)
+	t.Cleanup(func() {
+		c.Close()
+		client.Close()
+	})
+	return c
+}
+
+// Calls method with registry and returns response error code or zero
+func callCode(reg *Registry, c *conn.Conn, method string) spec.ErrorCode {
+	req := spec.NewRequest()
+	req.ID = 1
+	req.Method = method
+	resp := reg.Call(context.Background(), req, c)
+	if resp.Error != nil {
+		return resp.Error.Code
+	}
+	return 0
+}
+
+func TestPerMethodLimitUsesCanonicalName(t *testing.T) {
+	tests := []struct {
+		naming Naming
+		calls  []string
+	}{
+		{DefaultNaming, []string{"report.Generate", "report.generate", "report.make"}},
+		{Naming{Separator: "_", Case: CaseSnake}, []string{"report_generate", "report_make"}},
+		{Naming{Separator: "/", Case: CaseCamel}, []string{"report/generate", "report/make"}},
+	}
+	for _, test := range tests {
+		limiter := ratelimit.NewLimiter(ratelimit.Config{
+			PerMethod: map[string]ratelimit.Limit{"report.Generate": {Rate: 0.001, Burst: 1}},
+		})
+		reg, err := NewRegistry(WithNaming(test.naming), WithRateLimiter(limiter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Register("report", Reports{}, Alias("Generate", "make")); err != nil {
+			t.Fatal(err)
+		}
+		c := testConn(t)
+		if code := callCode(reg, c, test.calls[0]); code != 0 {
+			t.Fatalf("%s: first call failed with %d", test.calls[0], code)
+		}
+		for _, method := range test.calls[1:] {
+			if code := callCode(reg, c, method); code != spec.RateLimitedCode {
+				t.Fatalf("%s: expected rate limited, got %d", method, code)
+			}
+		}
+	}
+}
+
+func TestUnresolvedMethodsCountTowardsConnLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		PerConn: ratelimit.Limit{Rate: 0.001, Burst: 1},
+	})
+	reg, err := NewRegistry(WithRateLimiter(limiter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConn(t)
+	if code := callCode(reg, c, "missing.Method"); code != spec.MethodNotFoundCode {
+		t.Fatalf("expected method not found, got %d", code)
+	}
+	if code := callCode(reg, c, "missing.Method"); code != spec.RateLimitedCode {
+		t.Fatalf("expected rate limited, got %d", code)
+	}
+}
+
+type Greeter struct{}
+
+func (Greeter) Hello() string {
+	return "hello"
+}
+
+type GreeterV2 struct{}
+
+func (GreeterV2) Hello() string {
+	return "hello v2"
+}
+
+func (GreeterV2) Bye() string {
+	return "bye"
+}
+
+// Calls method and returns its result
+func callResult(t *testing.T, reg *Registry, c *conn.Conn, method string) interface{} {
+	t.Helper()
+	req := spec.NewRequest()
+	req.ID = 1
+	req.Method = method
+	resp := reg.Call(context.Background(), req, c)
+	if resp.Error != nil {
+		t.Fatalf("%s: %s", method, resp.Error.Message)
+	}
+	return resp.Result
+}
+
+func TestReplaceKeepsFuncs(t *testing.T) {
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("greeter", Greeter{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterFunc("greeter.Wave", func() string { return "wave" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Replace("greeter", GreeterV2{}); err != nil {
+		t.Fatal(err)
+	}
+	c := testConn(t)
+	for method, expected := range map[string]string{
+		"greeter.Hello": "hello v2",
+		"greeter.Bye":   "bye",
+		"greeter.Wave":  "wave",
+	} {
+		if got := callResult(t, reg, c, method); got != expected {
+			t.Fatalf("%s: got %v, expected %s", method, got, expected)
+		}
+	}
+
+	if err := reg.RegisterFunc("greeter.Bye", func() string { return "func" }); err == nil {
+		t.Fatal("expected error registering function with taken name")
+	}
+	if err := reg.RegisterFunc("other.Bye", func() string { return "bye" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Replace("other", GreeterV2{}); err == nil {
+		t.Fatal("expected error replacing service with method named as its function")
+	}
+	if got := callResult(t, reg, c, "other.Bye"); got != "bye" {
+		t.Fatalf("failed Replace changed service: got %v", got)
+	}
+}
+
+type Slow struct {
+	started chan struct{}
+}
+
+// Keeps running for a while after it is unsubscribed
+func (s Slow) Watch(sub *Subscription) error {
+	s.started <- struct{}{}
+	<-sub.Exit
+	time.Sleep(time.Millisecond * 100)
+	return nil
+}
+
+func TestUnregister(t *testing.T) {
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, other := Slow{started: make(chan struct{}, 1)}, Slow{started: make(chan struct{}, 1)}
+	if err := reg.Register("slow", slow); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("other", other); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("greeter", Greeter{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterFunc("greeter.Wave", func() string { return "wave" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterFunc("tools.Ping", func() string { return "pong" }); err != nil {
+		t.Fatal(err)
+	}
+	// Subscriptions are keyed by method name, so the same method of other
+	// service runs on its own connection
+	c, otherConn := testConn(t), testConn(t)
+	subscribe := func(s Slow, c *conn.Conn, method string) chan spec.ErrorCode {
+		done := make(chan spec.ErrorCode, 1)
+		go func() { done <- callCode(reg, c, method) }()
+		<-s.started
+		return done
+	}
+	slowDone := subscribe(slow, c, "slow.subscribe.Watch")
+	otherDone := subscribe(other, otherConn, "other.subscribe.Watch")
+
+	// Subscriptions of unregistered service are closed, others keep running
+	if err := reg.Unregister("slow", true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slowDone:
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscription of unregistered service is still running")
+	}
+	if n := subscriptionCount(reg, c.ID); n != 0 {
+		t.Fatalf("expected no subscriptions of unregistered service, counted %d", n)
+	}
+	if n := subscriptionCount(reg, otherConn.ID); n != 1 {
+		t.Fatalf("expected subscription of other service to run, counted %d", n)
+	}
+	select {
+	case code := <-otherDone:
+		t.Fatalf("subscription of other service ended with %d", code)
+	default:
+	}
+	if code := callCode(reg, c, "slow.subscribe.Watch"); code != spec.MethodNotFoundCode {
+		t.Fatalf("subscribe to unregistered service: got %d, expected method not found", code)
+	}
+
+	// Functions of the service are removed with it
+	if err := reg.Unregister("greeter", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"greeter.Hello", "greeter.Wave"} {
+		if code := callCode(reg, c, method); code != spec.MethodNotFoundCode {
+			t.Fatalf("%s: got %d, expected method not found", method, code)
+		}
+	}
+	if got := callResult(t, reg, c, "tools.Ping"); got != "pong" {
+		t.Fatalf("tools.Ping: got %v", got)
+	}
+	if err := reg.Unregister("greeter", false); err == nil {
+		t.Fatal("expected error unregistering missing service")
+	}
+
+	if code := callCode(reg, otherConn, "other.unsubscribe.Watch"); code != 0 {
+		t.Fatalf("unsubscribe of other service failed with %d", code)
+	}
+	<-otherDone
+}
+
+func TestEndedSubscriptionDoesNotRemoveNewerOne(t *testing.T) {
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := Slow{started: make(chan struct{}, 2)}
+	if err := reg.Register("slow", slow); err != nil {
+		t.Fatal(err)
+	}
+	c := testConn(t)
+	subscribe := func() chan spec.ErrorCode {
+		done := make(chan spec.ErrorCode, 1)
+		go func() { done <- callCode(reg, c, "slow.subscribe.Watch") }()
+		select {
+		case <-slow.started:
+		case <-time.After(time.Second * 5):
+			t.Fatal("subscription did not start")
+		}
+		return done
+	}
+	first := subscribe()
+	if code := callCode(reg, c, "slow.unsubscribe.Watch"); code != 0 {
+		t.Fatalf("unsubscribe failed with %d", code)
+	}
+	second := subscribe()
+	<-first
+	if !reg.HasSubscriptions(c.ID) {
+		t.Fatal("ended subscription removed the newer one")
+	}
+	if code := callCode(reg, c, "slow.unsubscribe.Watch"); code != 0 {
+		t.Fatalf("unsubscribe of newer subscription failed with %d", code)
+	}
+	<-second
+	if n := subscriptionCount(reg, c.ID); n != 0 {
+		t.Fatalf("expected no subscriptions after unsubscribe, counted %d", n)
+	}
+}
+
+func TestHasSubscriptions(t *testing.T) {
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := Slow{started: make(chan struct{}, 1)}
+	if err := reg.Register("slow", slow); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterTopic("orders.updates", nil); err != nil {
+		t.Fatal(err)
+	}
+	c, other := testConn(t), testConn(t)
+	if reg.HasSubscriptions(c.ID) {
+		t.Fatal("new connection has subscriptions")
+	}
+	done := make(chan spec.ErrorCode, 1)
+	go func() { done <- callCode(reg, c, "slow.subscribe.Watch") }()
+	<-slow.started
+	if code := callCode(reg, c, "orders.subscribe.updates"); code != 0 {
+		t.Fatalf("topic subscribe failed with %d", code)
+	}
+	if !reg.HasSubscriptions(c.ID) || reg.HasSubscriptions(other.ID) {
+		t.Fatal("subscriptions counted for wrong connection")
+	}
+	if code := callCode(reg, c, "orders.unsubscribe.updates"); code != 0 {
+		t.Fatalf("topic unsubscribe failed with %d", code)
+	}
+	if !reg.HasSubscriptions(c.ID) {
+		t.Fatal("connection with running subscription has no subscriptions")
+	}
+	if code := callCode(reg, c, "slow.unsubscribe.Watch"); code != 0 {
+		t.Fatalf("unsubscribe failed with %d", code)
+	}
+	<-done
+	if reg.HasSubscriptions(c.ID) {
+		t.Fatal("connection has subscriptions after unsubscribing all")
+	}
+
+	// Count goes back to zero after every unsubscribe
+	for i := 0; i < 3; i++ {
+		if code := callCode(reg, c, "orders.subscribe.updates"); code != 0 {
+			t.Fatalf("topic subscribe failed with %d", code)
+		}
+		if n := subscriptionCount(reg, c.ID); n != 1 {
+			t.Fatalf("expected 1 subscription, counted %d", n)
+		}
+		if code := callCode(reg, c, "orders.unsubscribe.updates"); code != 0 {
+			t.Fatalf("topic unsubscribe failed with %d", code)
+		}
+		if n := subscriptionCount(reg, c.ID); n != 0 {
+			t.Fatalf("expected no subscriptions after unsubscribe, counted %d", n)
+		}
+	}
+	if len(reg.connSubscriptions) != 0 {
+		t.Fatalf("counts left for connections %v", reg.connSubscriptions)
+	}
+}
+
+// Returns number of subscriptions counted for connection
+func subscriptionCount(reg *Registry, connID string) int {
+	reg.subscriptions.Lock()
+	defer reg.subscriptions.Unlock()
+	return reg.connSubscriptions[connID]
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exported method of a service that is not exposed
+type SkippedMethod struct {
+	Name string
+
+	// Why method is not exposed, i.e. "excluded"
+	Reason string
+}
+
+// Report of a service registered with RegisterWithReport
+type Report struct {
+	Service string
+
+	// Methods and subscriptions exposed to clients sorted by name
+	Exposed []MethodInfo
+
+	// Exported methods excluded with Exclude or ExcludeFunc and methods
+	// with pointer receivers when a struct value is registered
+	Skipped []SkippedMethod
+}
+
+// Formats report one method per line, i.e.
+//
+//	service example: 2 exposed, 1 skipped
+//	  call example.Simple(int, int) int
+//	  subscription example.subscribe.Time() time.Time
+//	  skipped Close: excluded
+func (r *Report) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "service %s: %d exposed, %d skipped", r.Service, len(r.Exposed), len(r.Skipped))
+	for _, info := range r.Exposed {
+		fmt.Fprintf(b, "\n  %s %s", info.Kind, info.Signature())
+	}
+	for _, m := range r.Skipped {
+		fmt.Fprintf(b, "\n  skipped %s: %s", m.Name, m.Reason)
+	}
+	return b.String()
+}
+
+// Formats registered methods, subscriptions and topics as a table with
+// name, kind, params and result type, i.e. for logging at startup
+/*
+	log.Printf("methods:\n%s", reg.MethodTable())
+*/
+func (reg *Registry) MethodTable() string {
+	b := &strings.Builder{}
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tPARAMS\tRESULT")
+	for _, info := range reg.Methods() {
+		params := make([]string, len(info.Params))
+		for i, t := range info.Params {
+			params[i] = t.String()
+		}
+		args, result := strings.Join(params, ", "), "-"
+		if args == "" {
+			args = "-"
+		}
+		if info.Result != nil {
+			result = info.Result.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, info.Kind, args, result)
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Counter struct {
+	value int
+}
+
+func (c Counter) Get() int {
+	return c.value
+}
+
+func (c *Counter) Inc() int {
+	c.value++
+	return c.value
+}
+
+func (c *Counter) Close() {}
+
+// Names of exposed methods in report
+func exposedNames(report *Report) []string {
+	names := []string{}
+	for _, m := range report.Exposed {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestReportPointerReceivers(t *testing.T) {
+	tests := []struct {
+		service interface{}
+		exposed []string
+		skipped []SkippedMethod
+	}{
+		{
+			service: Counter{},
+			exposed: []string{"counter.Get"},
+			skipped: []SkippedMethod{
+				{Name: "Close", Reason: "excluded"},
+				{Name: "Inc", Reason: "has pointer receiver, register a pointer to expose it"},
+			},
+		},
+		{
+			service: &Counter{},
+			exposed: []string{"counter.Get", "counter.Inc"},
+			skipped: []SkippedMethod{{Name: "Close", Reason: "excluded"}},
+		},
+	}
+	for _, test := range tests {
+		reg, err := NewRegistry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := reg.RegisterWithReport("counter", test.service, Exclude("Close"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := exposedNames(report); !reflect.DeepEqual(got, test.exposed) {
+			t.Fatalf("%T: exposed %v, expected %v", test.service, got, test.exposed)
+		}
+		if !reflect.DeepEqual(report.Skipped, test.skipped) {
+			t.Fatalf("%T: skipped %v, expected %v", test.service, report.Skipped, test.skipped)
+		}
+	}
+}
+
+func TestPointerServiceKeepsState(t *testing.T) {
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &Counter{}
+	if err := reg.Register("counter", counter); err != nil {
+		t.Fatal(err)
+	}
+	c := testConn(t)
+	callCode(reg, c, "counter.Inc")
+	callCode(reg, c, "counter.Inc")
+	if counter.value != 2 {
+		t.Fatalf("registered counter has value %d, expected 2", counter.value)
+	}
+}
+
+// Services with one valid method and one unsupported signature
+type TooManyResults struct{}
+
+func (TooManyResults) Ok() int                { return 1 }
+func (TooManyResults) Bad() (int, int, error) { return 0, 0, nil }
+
+type LastNotError struct{}
+
+func (LastNotError) Ok() int            { return 1 }
+func (LastNotError) Bad() (int, string) { return 0, "" }
+
+type TwoErrors struct{}
+
+func (TwoErrors) Ok() int             { return 1 }
+func (TwoErrors) Bad() (error, error) { return nil, nil }
+
+type ContextNotFirst struct{}
+
+func (ContextNotFirst) Ok() int                            { return 1 }
+func (ContextNotFirst) Bad(x int, ctx context.Context) int { return x }
+
+type SubscriptionNotFirst struct{}
+
+func (SubscriptionNotFirst) Ok() int                            { return 1 }
+func (SubscriptionNotFirst) Bad(x int, sub *Subscription) error { return nil }
+
+type ChannelArgument struct{}
+
+func (ChannelArgument) Ok() int         { return 1 }
+func (ChannelArgument) Bad(ch chan int) {}
+
+type VariadicArguments struct{}
+
+func (VariadicArguments) Ok() int           { return 1 }
+func (VariadicArguments) Bad(xs ...int) int { return len(xs) }
+
+func TestRegisterRejectsInvalidSignatures(t *testing.T) {
+	tests := []struct {
+		service interface{}
+		err     string
+	}{
+		{TooManyResults{}, "method Bad has 3 results, expected at most result and error"},
+		{LastNotError{}, "method Bad returns string as the second result, expected error"},
+		{TwoErrors{}, "method Bad returns two errors, expected result and error"},
+		{ContextNotFirst{}, "method Bad has context.Context that is not the first argument"},
+		{SubscriptionNotFirst{}, "method Bad has *Subscription that is not the first argument after optional context.Context"},
+		{ChannelArgument{}, "method Bad has argument of type chan int that can not be decoded from json"},
+		{VariadicArguments{}, "method Bad has variadic arguments"},
+	}
+	for _, test := range tests {
+		reg, err := NewRegistry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		builtin := len(reg.Methods())
+		err = reg.Register("svc", test.service)
+		if err == nil || !strings.Contains(err.Error(), test.err) || !strings.Contains(err.Error(), "registry.Exclude") {
+			t.Fatalf("%T: got error %v, expected %q", test.service, err, test.err)
+		}
+		report, err := reg.RegisterWithReport("svc", test.service)
+		if err == nil || report != nil {
+			t.Fatalf("%T: expected error without report, got %v", test.service, report)
+		}
+		if methods := reg.Methods(); len(methods) != builtin {
+			t.Fatalf("%T: failed registration added methods %v", test.service, methods)
+		}
+
+		// Excluded method is reported as skipped
+		report, err = reg.RegisterWithReport("svc", test.service, Exclude("Bad"))
+		if err != nil {
+			t.Fatalf("%T: %s", test.service, err)
+		}
+		if got := exposedNames(report); !reflect.DeepEqual(got, []string{"svc.Ok"}) {
+			t.Fatalf("%T: exposed %v", test.service, got)
+		}
+		expected := "service svc: 1 exposed, 1 skipped\n  call svc.Ok() int\n  skipped Bad: excluded"
+		if got := report.String(); got != expected {
+			t.Fatalf("%T: report\n%s\nexpected\n%s", test.service, got, expected)
+		}
+	}
+}
+
+func TestRegisterFuncRejectsInvalidSignatures(t *testing.T) {
+	tests := []struct {
+		fn  interface{}
+		err string
+	}{
+		{func() (int, int, error) { return 0, 0, nil }, "function svc.Bad: has 3 results"},
+		{func() (int, string) { return 0, "" }, "function svc.Bad: returns string as the second result"},
+		{func(x int, sub *Subscription) error { return nil }, "function svc.Bad: has *Subscription that is not the first argument"},
+		{42, "svc.Bad must be a function, got int"},
+	}
+	reg, err := NewRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if err := reg.RegisterFunc("svc.Bad", test.fn); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%T: got error %v, expected %q", test.fn, err, test.err)
+		}
+	}
+	if reg.FindMethod("svc", "bad") != nil {
+		t.Fatal("invalid function was registered")
+	}
+}
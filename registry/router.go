@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/kroksys/jrpc/spec"
+)
+
+// RouteKind tells what a request does with resolved method
+type RouteKind int
+
+const (
+	// Calls method and returns its result
+	RouteCall RouteKind = iota
+
+	// Starts subscription or subscribes to topic
+	RouteSubscribe
+
+	// Stops subscription or unsubscribes from topic
+	RouteUnsubscribe
+)
+
+func (k RouteKind) String() string {
+	switch k {
+	case RouteSubscribe:
+		return "subscribe"
+	case RouteUnsubscribe:
+		return "unsubscribe"
+	}
+	return "call"
+}
+
+// Method name of a request resolved by Router
+type Route struct {
+	Kind RouteKind
+
+	// Service name, i.e. "billing.invoices"
+	Service string
+
+	// Method or subscription to execute. Nil for topics.
+	Method *Method
+
+	// Topic to subscribe or unsubscribe. Nil for methods.
+	Topic *Topic
+
+	// Params passed to method. Differ from request params when
+	// subscription name is sent in params.
+	Params interface{}
+}
+
+// Canonical name of resolved method or topic, i.e. "report.Generate" for
+// "report_generate" or an alias. Used to apply per method rate limits.
+func (r *Route) name() string {
+	if r.Topic != nil {
+		return r.Topic.Name
+	}
+	return r.Service + "." + r.Method.name
+}
+
+// Router resolves method name and params of a request to a registered
+// method or topic. Requests and notifications are resolved the same way.
+/*
+	type legacyRouter struct{}
+
+	func (legacyRouter) Route(reg *registry.Registry, method string, params interface{}) (*registry.Route, *spec.Error) {
+		if method == "add" {
+			return &registry.Route{Service: "example", Method: reg.FindMethod("example", "simple"), Params: params}, nil
+		}
+		return registry.DefaultRouter{}.Route(reg, method, params)
+	}
+*/
+type Router interface {
+	Route(reg *Registry, method string, params interface{}) (*Route, *spec.Error)
+}
+
+// Router resolving method names using Registry.Naming, i.e.
+// "example.Simple", "example.subscribe.Subscription" or nested namespace
+// "billing.invoices.List". Service of a call is the longest registered
+// service name the method starts with.
+type DefaultRouter struct{}
+
+func (DefaultRouter) Route(reg *Registry, method string, params interface{}) (*Route, *spec.Error) {
+	name, ok := reg.Naming.parse(method, reg.hasService)
+	if !ok {
+		return nil, spec.NewError(spec.MethodNotFoundCode, "invalid method name")
+	}
+	name, params, err := reg.Naming.subscriptionParam(name, params)
+	if err != nil {
+		return nil, spec.NewError(spec.InvalidParamsCode, err.Error())
+	}
+	route := &Route{Service: name.service, Params: params}
+	switch name.action {
+	case "":
+		route.Kind = RouteCall
+		route.Method = reg.findMethod(name)
+		if route.Method == nil {
+			return nil, spec.NewError(spec.MethodNotFoundCode,
+				fmt.Sprintf("missing services %s method %s", name.service, name.name))
+		}
+		return route, nil
+	case "subscribe":
+		route.Kind = RouteSubscribe
+	default:
+		route.Kind = RouteUnsubscribe
+	}
+	if route.Topic = reg.findTopic(name); route.Topic != nil {
+		return route, nil
+	}
+	route.Method = reg.findSubscription(name)
+	if route.Method == nil {
+		return nil, spec.NewError(spec.MethodNotFoundCode,
+			fmt.Sprintf("missing subscription %s", method))
+	}
+	return route, nil
+}
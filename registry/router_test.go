@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kroksys/jrpc/spec"
+)
+
+type Blocks struct{}
+
+func (Blocks) GetBlockNumber() int {
+	return 1
+}
+
+func (Blocks) NewHeads(sub *Subscription) error {
+	return nil
+}
+
+// Expected route: kind, service, method or topic name and params
+type expectedRoute struct {
+	kind    RouteKind
+	service string
+	name    string
+	params  interface{}
+}
+
+func TestDefaultRouter(t *testing.T) {
+	tests := []struct {
+		naming Naming
+		method string
+		params interface{}
+		route  expectedRoute
+		code   spec.ErrorCode
+	}{
+		{DefaultNaming, "eth.GetBlockNumber", nil, expectedRoute{RouteCall, "eth", "GetBlockNumber", nil}, 0},
+		{DefaultNaming, "eth.getblocknumber", nil, expectedRoute{RouteCall, "eth", "GetBlockNumber", nil}, 0},
+		{DefaultNaming, "eth.subscribe.NewHeads", nil, expectedRoute{RouteSubscribe, "eth", "NewHeads", nil}, 0},
+		{DefaultNaming, "eth.unsubscribe.newheads", nil, expectedRoute{RouteUnsubscribe, "eth", "NewHeads", nil}, 0},
+		{DefaultNaming, "eth.subscribe", nil, expectedRoute{RouteSubscribe, "eth", "NewHeads", nil}, 0},
+		{DefaultNaming, "eth.subscribe.Blocks", nil, expectedRoute{RouteSubscribe, "eth", "eth.blocks", nil}, 0},
+		{DefaultNaming, "chain.eth.GetBlockNumber", nil, expectedRoute{RouteCall, "chain.eth", "GetBlockNumber", nil}, 0},
+		{DefaultNaming, "eth.Missing", nil, expectedRoute{}, spec.MethodNotFoundCode},
+		{DefaultNaming, "eth", nil, expectedRoute{}, spec.MethodNotFoundCode},
+		{Naming{Separator: "_", Case: CaseSnake}, "eth_get_block_number", nil, expectedRoute{RouteCall, "eth", "GetBlockNumber", nil}, 0},
+		{Naming{Separator: "_", Case: CaseSnake}, "eth_GetBlockNumber", nil, expectedRoute{}, spec.MethodNotFoundCode},
+		{Naming{Separator: "/", Case: CaseExact}, "eth/GetBlockNumber", nil, expectedRoute{RouteCall, "eth", "GetBlockNumber", nil}, 0},
+		{Naming{Separator: "/", Case: CaseExact}, "eth/getBlockNumber", nil, expectedRoute{}, spec.MethodNotFoundCode},
+		{EthereumNaming, "eth_getBlockNumber", nil, expectedRoute{RouteCall, "eth", "GetBlockNumber", nil}, 0},
+		{EthereumNaming, "eth_subscribe", []interface{}{"newHeads", true}, expectedRoute{RouteSubscribe, "eth", "NewHeads", []interface{}{true}}, 0},
+		{EthereumNaming, "eth_unsubscribe", []interface{}{"newHeads"}, expectedRoute{RouteUnsubscribe, "eth", "NewHeads", []interface{}{}}, 0},
+		{EthereumNaming, "eth_subscribe_newHeads", nil, expectedRoute{RouteSubscribe, "eth", "NewHeads", nil}, 0},
+		{EthereumNaming, "eth_subscribe", nil, expectedRoute{}, spec.InvalidParamsCode},
+		{EthereumNaming, "eth_subscribe", []interface{}{1}, expectedRoute{}, spec.InvalidParamsCode},
+	}
+	for _, test := range tests {
+		reg, err := NewRegistry(WithNaming(test.naming))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"eth", "chain.eth"} {
+			if err := reg.Register(name, Blocks{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := reg.RegisterTopic("eth.Blocks", nil); err != nil {
+			t.Fatal(err)
+		}
+		route, rpcErr := DefaultRouter{}.Route(reg, test.method, test.params)
+		if test.code != 0 {
+			if rpcErr == nil || rpcErr.Code != test.code {
+				t.Fatalf("%s: expected error %d, got %v %v", test.method, test.code, route, rpcErr)
+			}
+			continue
+		}
+		if rpcErr != nil {
+			t.Fatalf("%s: %v", test.method, rpcErr)
+		}
+		got := expectedRoute{kind: route.Kind, service: route.Service, params: route.Params}
+		if route.Topic != nil {
+			got.name = route.Topic.Name
+		} else {
+			got.name = route.Method.name
+		}
+		if !reflect.DeepEqual(got, test.route) {
+			t.Fatalf("%s: got %+v, expected %+v", test.method, got, test.route)
+		}
+	}
+}
@@ -1,8 +1,39 @@
 package registry
 
+import "fmt"
+
 // Service represents struct with its methods and is registered with a name
 type Service struct {
 	Name          string
 	methods       map[string]*Method
 	subscriptions map[string]*Method
 }
+
+// Copies functions registered with RegisterFunc from old implementation of
+// the service. Returns error when a method has the same name as one of them.
+func (s *Service) keepFuncs(old Service) error {
+	funcs := func(methods map[string]*Method) (map[string]*Method, error) {
+		result := map[string]*Method{}
+		for key, m := range methods {
+			if m.receiver.IsValid() {
+				continue
+			}
+			if s.methods[key] != nil || s.subscriptions[key] != nil {
+				return nil, fmt.Errorf("method %s.%s conflicts with function added with RegisterFunc", s.Name, m.name)
+			}
+			result[key] = m
+		}
+		return result, nil
+	}
+	methods, err := funcs(old.methods)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := funcs(old.subscriptions)
+	if err != nil {
+		return err
+	}
+	s.methods = mergeMethods(s.methods, methods)
+	s.subscriptions = mergeMethods(s.subscriptions, subscriptions)
+	return nil
+}
@@ -1,7 +1,6 @@
 package registry
 
 import (
-	"encoding/json"
 	"log"
 	"sync"
 
@@ -20,6 +19,9 @@ type Subscription struct {
 	// ID provided by client request
 	MessageID interface{}
 
+	// Params provided by client request
+	Params interface{}
+
 	// Pointer to connection used to send data
 	Conn *conn.Conn
 
@@ -29,6 +31,12 @@ type Subscription struct {
 
 	// Executed method name for subscription
 	methodName string
+
+	// Service of executed method, empty for topic subscriptions
+	service string
+
+	logger Logger
+	codec  spec.Codec
 }
 
 // Creates new Subscription with its name and write channel.
@@ -43,6 +51,8 @@ func NewSubscription(methodName string, id interface{}, c *conn.Conn, logsOn boo
 		Exit:       make(chan interface{}),
 		methodName: methodName,
 		LogsOn:     logsOn,
+		logger:     log.Default(),
+		codec:      spec.DefaultCodec,
 	}
 }
 
@@ -77,16 +87,16 @@ func (s *Subscription) IsRunning() bool {
 func (s *Subscription) Notify(data interface{}) error {
 	n := spec.NewResponse(s.MessageID, data)
 
-	responseData, err := json.Marshal(n)
+	responseData, err := s.codec.Marshal(n)
 	if err != nil {
 		if s.LogsOn {
-			log.Printf("Error:%s:json.Marshal error: %s\n", s.methodName, err.Error())
+			s.logger.Printf("Error:%s:codec.Marshal error: %s\n", s.methodName, err.Error())
 		}
 		return err
 	}
 
 	if s.LogsOn {
-		log.Printf("Response:%s Id:%v Result:%.*v\n", s.methodName, n.ID, 20, n.Result)
+		s.logger.Printf("Response:%s Id:%v Result:%.*v\n", s.methodName, n.ID, 20, n.Result)
 	}
 	err = s.Conn.Send(responseData)
 	if err != nil {
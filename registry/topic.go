@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"github.com/kroksys/pool"
+)
+
+// TopicFilter decides if published payload should be delivered to a
+// subscription. Params are the parameters client sent when subscribing.
+// Returning false skips the subscription for this payload.
+type TopicFilter func(params interface{}, payload interface{}) bool
+
+// Topic represents a server side published stream. Clients subscribe to a
+// topic the same way as to a subscription method, i.e. topic "orders.updates"
+// is subscribed with "orders.subscribe.updates" and server code publishes
+// data using Registry.Publish("orders.updates", payload).
+type Topic struct {
+	Name   string
+	filter TopicFilter
+
+	// Active subscriptions of this topic.
+	// Subscription[key] - key = conn.Conn.ID + topic.Name
+	subscriptions *pool.PoolStr[*Subscription]
+}
+
+// Creates new Topic with its name and optional filter
+func NewTopic(name string, filter TopicFilter) *Topic {
+	return &Topic{
+		Name:          name,
+		filter:        filter,
+		subscriptions: pool.NewPoolStr[*Subscription](),
+	}
+}
+
+// Sends payload to every subscription accepted by the filter.
+// Returns number of subscriptions that received the payload.
+func (t *Topic) publish(payload interface{}) int {
+	subs := []*Subscription{}
+	t.subscriptions.Each(func(sub *Subscription) {
+		subs = append(subs, sub)
+	})
+	count := 0
+	for _, sub := range subs {
+		if !sub.IsRunning() {
+			continue
+		}
+		if t.filter != nil && !t.filter(sub.Params, payload) {
+			continue
+		}
+		if sub.Notify(payload) == nil {
+			count++
+		}
+	}
+	return count
+}
@@ -2,33 +2,188 @@ package jrpc
 
 import (
 	"context"
-	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc/bus"
 	"github.com/kroksys/jrpc/conn"
 	"github.com/kroksys/jrpc/registry"
 	"github.com/kroksys/jrpc/spec"
 )
 
 const (
-	pingPeriod = time.Second * 30
+	DefaultPingPeriod     = time.Second * 30
+	DefaultMaxMissedPongs = 3
 )
 
 // Server is just a parent for json-rpc server using websockets
 type Server struct {
 	*registry.Registry
 	LogsOn bool
+
+	// Logger used when logs are turned on
+	Logger registry.Logger
+
+	// Codec used to decode incoming and encode outgoing messages
+	Codec spec.Codec
+
+	// Upgrader used to upgrade http connections to websocket
+	Upgrader ws.HTTPUpgrader
+
+	// Origins allowed to open connections, i.e. "https://example.com",
+	// "*.example.com" or "*". When empty only the same origin is allowed.
+	// Requests without Origin header are always allowed.
+	AllowedOrigins []string
+
+	// Subprotocols supported by the server in preferred order. When set
+	// client must request one of them (i.e. "jsonrpc-2.0").
+	Subprotocols []string
+
+	// Headers added to every upgrade response
+	ResponseHeader http.Header
+
+	// Hook called when upgrade request is rejected with response status
+	OnUpgradeReject func(r *http.Request, status int, err error)
+
+	// Resolves authenticated principal of the connection from upgrade request
+	Principal func(r *http.Request) string
+
+	// Hooks called when connection is accepted and when it is closed
+	OnConnect    func(c *conn.Conn)
+	OnDisconnect func(c *conn.Conn, err error)
+
+	// Settings for every accepted connection (write deadline, queue size)
+	ConnConfig conn.Config
+
+	// Interval between pings sent to every connection. Heartbeat and idle
+	// checks are done on the same interval.
+	PingPeriod time.Duration
+
+	// Connection is closed when nothing (pong or message) was received from
+	// it for this many ping periods. Zero disables the check.
+	MaxMissedPongs int
+
+	// Connection without subscriptions is closed when no message was
+	// received from it for this duration. Zero disables the check.
+	IdleTimeout time.Duration
+
+	// Limits checked on received messages before decoding them
+	Limits spec.Limits
+
+	// Maximum number of calls executed at the same time on a single
+	// connection. Calls over the limit wait in a queue of the same size and
+	// the connection is not read while it is full. In sequential mode it is
+	// the size of the queue. Zero means no limit.
+	MaxInFlight int
+
+	// When connection reaches MaxInFlight new calls are rejected with
+	// server busy error instead of waiting for a free slot.
+	RejectWhenBusy bool
+
+	// Execute calls of a connection one by one in arrival order.
+	// Subscriptions are still running concurrently.
+	Sequential bool
+
+	// Maximum number of calls executed at the same time. Zero means no limit.
+	MaxConcurrentCalls int
+	calls              chan struct{}
+
+	// Bus used to publish topic messages to every node
+	bus bus.Bus
+
+	registryOpts []registry.Option
 }
 
-// Creates new server with initialised registry
-func NewServer(logsOn bool) *Server {
-	return &Server{
-		Registry: registry.NewRegistry(logsOn),
-		LogsOn:   logsOn,
+// Creates new server with initialised registry and in-process bus.
+// Returns error if options are invalid or conflict with each other.
+/*
+	jrpcServer, err := jrpc.NewServer(
+		jrpc.WithLogs(true),
+		jrpc.WithPingPeriod(time.Second*10),
+		jrpc.WithReadLimit(1<<20),
+	)
+*/
+func NewServer(opts ...Option) (*Server, error) {
+	s := &Server{
+		Logger:         log.Default(),
+		Codec:          spec.DefaultCodec,
+		ConnConfig:     conn.DefaultConfig(),
+		PingPeriod:     DefaultPingPeriod,
+		MaxMissedPongs: DefaultMaxMissedPongs,
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	s.ConnConfig.Codec = s.Codec
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	reg, err := registry.NewRegistry(append([]registry.Option{
+		registry.WithLogs(s.LogsOn),
+		registry.WithLogger(s.Logger),
+		registry.WithCodec(s.Codec),
+	}, s.registryOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	s.Registry = reg
+	if s.MaxConcurrentCalls > 0 {
+		s.calls = make(chan struct{}, s.MaxConcurrentCalls)
+	}
+	if s.bus == nil {
+		s.bus = bus.NewLocal()
+	}
+	s.SetBus(s.bus)
+	return s, nil
+}
+
+// Creates new server with logs turned on or off and default settings.
+// Kept for callers of the former NewServer(logsOn bool). Default settings
+// are always valid, so it does not return error and panics if NewServer
+// ever fails with them.
+func NewServerWithLogs(logsOn bool) *Server {
+	s, err := NewServer(WithLogs(logsOn))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Sets bus used by Publish. When running multiple nodes use a bus that
+// connects them (i.e. bus.NewTCP) so topic messages reach subscribers
+// connected to any node. Should be called before the server starts.
+func (s *Server) SetBus(b bus.Bus) {
+	s.bus = b
+	b.Subscribe(s.deliver)
+}
+
+// Publish payload to the topic registered with RegisterTopic. Payload is
+// sent through the bus and delivered to topic subscribers on every node.
+// Filters receive payload decoded from json, the same way as on remote nodes.
+// Returns error only when payload was not published, so it is safe to retry.
+func (s *Server) Publish(topic string, payload interface{}) error {
+	data, err := s.Codec.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.bus.Publish(topic, data)
+}
+
+// Delivers message received from the bus to local topic subscribers
+func (s *Server) deliver(topic string, payload []byte) {
+	var data interface{}
+	if err := s.Codec.Unmarshal(payload, &data); err != nil {
+		s.logf("%s:bus codec.Unmarshal error: %s\n", topic, err.Error())
+		return
+	}
+	if _, err := s.Registry.Publish(topic, data); err != nil {
+		s.logf("%s:publish error: %s\n", topic, err.Error())
 	}
 }
 
@@ -36,81 +191,117 @@ func NewServer(logsOn bool) *Server {
 // and parsing incoming messages as jrpc objects.
 // When receives jrpc object it tries to execute a method from registry.
 func (s *Server) defaultConnHandler(c *conn.Conn, ctx context.Context) {
-	defer c.Close()
+	defer func() {
+		c.Close()
+		<-c.Done()
+	}()
+	if s.OnDisconnect != nil {
+		c.OnClose(s.OnDisconnect)
+	}
+	if s.OnConnect != nil {
+		s.OnConnect(c)
+	}
+	pingPeriod := s.PingPeriod
+	if pingPeriod <= 0 {
+		pingPeriod = DefaultPingPeriod
+	}
 	pinger := time.NewTicker(pingPeriod)
 	defer pinger.Stop()
+	exec := s.newExecState(c)
 	for {
 		select {
 		case <-pinger.C:
+			if !s.checkHeartbeat(c, pingPeriod) {
+				return
+			}
 			c.Ping()
 		case _, running := <-c.Exit:
 			if !running {
 				return
 			}
-		case msg := <-c.In:
-			go func() {
-				data, tp := spec.Parse(msg)
-				switch tp {
-				case spec.TypeRequest:
-					request := data.(spec.Request)
-					if s.LogsOn {
-						log.Printf("Request Id:%v Method:%s Params: %v\n", request.ID, request.Method, request.Params)
-					}
-					resp := s.Registry.Call(ctx, request, c)
-					responseData, err := json.Marshal(resp)
-					if err != nil {
-						return
-					}
-					if s.LogsOn {
-						log.Printf("Response Id:%v Result:%v Err: %v\n", resp.ID, resp.Result, resp.Error)
-					}
-					c.Send(responseData)
-				case spec.TypeNotification:
-					notification := data.(spec.Notification)
-					if s.LogsOn {
-						log.Printf("Method:%s Params: %v\n", notification.Method, notification.Params)
-					}
-					err := s.Registry.Subscribe(ctx, notification, c)
-					if err != nil {
-						if s.LogsOn {
-							log.Printf("%s:error: %v\n", notification.Method, err)
-						}
-						errData, err := json.Marshal(err)
-						if err != nil {
-							if s.LogsOn {
-								log.Printf("%s:json.Marshal error: %s\n", notification.Method, err.Error())
-							}
-							return
-						}
-						c.Send(errData)
-					}
-				}
-			}()
+		case msg, ok := <-c.In:
+			if !ok {
+				return
+			}
+			if !s.dispatch(ctx, c, msg, exec) {
+				return
+			}
 		}
 	}
 }
 
+// Waits for a free call slot when MaxConcurrentCalls is set. Subscriptions
+// are not limited because they block while running. Returns func that
+// releases the slot.
+func (s *Server) acquire(request spec.Request) func() {
+	if s.calls == nil || s.Registry.IsSubscriptionRequest(request) {
+		return func() {}
+	}
+	s.calls <- struct{}{}
+	return func() { <-s.calls }
+}
+
+// Prints log when logs are turned on
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.LogsOn {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// Closes connection that missed too many heartbeats or is idle for too long.
+// Returns false when connection was closed.
+func (s *Server) checkHeartbeat(c *conn.Conn, pingPeriod time.Duration) bool {
+	if s.MaxMissedPongs > 0 && time.Since(c.LastRead()) > pingPeriod*time.Duration(s.MaxMissedPongs) {
+		s.logf("Conn:%s heartbeat timeout\n", c.ID)
+		c.CloseNow(conn.StatusGoingAway, "heartbeat timeout")
+		return false
+	}
+	if s.IdleTimeout > 0 && time.Since(c.LastMessage()) > s.IdleTimeout && !s.Registry.HasSubscriptions(c.ID) {
+		s.logf("Conn:%s idle timeout\n", c.ID)
+		c.CloseNow(conn.StatusNormal, "idle timeout")
+		return false
+	}
+	return true
+}
+
+// Wraps upgraded net.Conn with jrpc Conn and sets its principal
+// and negotiated subprotocol. Principal is not resolved without request.
+func (s *Server) newConn(cn net.Conn, r *http.Request, protocol string) *conn.Conn {
+	c := conn.NewConnConfig(cn, s.ConnConfig)
+	c.SetProtocol(protocol)
+	if s.Principal != nil && r != nil {
+		c.SetPrincipal(s.Principal(r))
+	}
+	return c
+}
+
 // Go gin handler. There is a bug that this handler does not work
 // with gin Group. Have no idea why. So its mandatory to use
 // gin router.GET() to register the route.
 func (s *Server) WebsocketHandlerGin(g *gin.Context) {
-	cn, _, _, err := ws.UpgradeHTTP(g.Request, g.Writer)
+	cn, protocol, err := s.upgrade(g.Writer, g.Request)
 	if err != nil {
-		log.Printf("upgrade error: %s", err)
 		return
 	}
 	defer cn.Close()
-	s.defaultConnHandler(conn.NewConn(cn), g)
+	s.defaultConnHandler(s.newConn(cn, g.Request, protocol), g)
 }
 
 // Http server handler to upgrade net.Conn to jrpc Conn and
 // forwards connection handling to the connection gorutines.
 func (s *Server) WebsocketHandler(w http.ResponseWriter, r *http.Request) {
-	cn, _, _, err := ws.UpgradeHTTP(r, w)
+	cn, protocol, err := s.upgrade(w, r)
 	if err != nil {
-		log.Printf("upgrade error: %s", err)
 		return
 	}
 	defer cn.Close()
-	s.defaultConnHandler(conn.NewConn(cn), r.Context())
+	s.defaultConnHandler(s.newConn(cn, r, protocol), r.Context())
+}
+
+// Serves websocket connection that is already upgraded, i.e. one side of
+// net.Pipe in tests or connection upgraded by another library. Blocks until
+// connection is closed.
+func (s *Server) ServeConn(ctx context.Context, cn net.Conn) {
+	defer cn.Close()
+	s.defaultConnHandler(s.newConn(cn, nil, ""), ctx)
 }
@@ -0,0 +1,333 @@
+package jrpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc"
+	"github.com/kroksys/jrpc/conn"
+	"github.com/kroksys/jrpc/jrpctest"
+	"github.com/kroksys/jrpc/spec"
+)
+
+func TestCall(t *testing.T) {
+	h := newMathHarness(t)
+	h.Call(t, "math.Add", []int{1, 2}).Expect(3)
+	h.Call(t, "math.add", []int{2, 2}).Expect(4)
+	h.Call(t, "math.Add", []string{"a"}).ExpectError(spec.InvalidParamsCode)
+	h.Call(t, "math.Missing", nil).ExpectError(spec.MethodNotFoundCode)
+}
+
+func TestBatch(t *testing.T) {
+	h := newMathHarness(t)
+	raw := h.Raw(t)
+
+	responses := decodeBatch(t, raw.Roundtrip(`[
+		{"jsonrpc":"2.0","id":1,"method":"math.Add","params":[1,2]},
+		{"jsonrpc":"2.0","method":"math.Add","params":[3,4]},
+		{"jsonrpc":"2.0","id":2,"method":"math.Missing"},
+		{"jsonrpc":"2.0","id":3,"method":"math.Add","params":["a"]}
+	]`))
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses without notification, got %v", responses)
+	}
+	if resp := responses[1]; resp.Error != nil || resp.Result != float64(3) {
+		t.Fatalf("math.Add: unexpected response %+v", resp)
+	}
+	if resp := responses[2]; resp.Error == nil || resp.Error.Code != spec.MethodNotFoundCode {
+		t.Fatalf("math.Missing: unexpected response %+v", resp)
+	}
+	if resp := responses[3]; resp.Error == nil || resp.Error.Code != spec.InvalidParamsCode {
+		t.Fatalf("math.Add with invalid params: unexpected response %+v", resp)
+	}
+}
+
+func TestBatchLimit(t *testing.T) {
+	h := newMathHarness(t, jrpc.WithMaxBatch(2))
+	raw := h.Raw(t)
+
+	var resp spec.Response
+	msg := raw.Roundtrip(`[{"jsonrpc":"2.0","id":1,"method":"math.Add","params":[1,2]},
+		{"jsonrpc":"2.0","id":2,"method":"math.Add","params":[1,2]},
+		{"jsonrpc":"2.0","id":3,"method":"math.Add","params":[1,2]}]`)
+	if err := spec.DefaultCodec.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("invalid response %s: %s", msg, err)
+	}
+	if resp.Error == nil || resp.Error.Code != spec.InvalidRequestCode {
+		t.Fatalf("expected invalid request, got %s", msg)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := newMathHarness(t)
+	sub := h.Subscribe(t, "math.subscribe.Counter", nil)
+	sub.Expect(1)
+	h.Call(t, "math.subscribe.Counter", nil).ExpectError(spec.InternalErrorCode)
+	sub.Unsubscribe()
+	h.Call(t, "math.unsubscribe.Counter", nil).ExpectError(spec.InternalErrorCode)
+
+	// Subscribing again after unsubscribe starts a new subscription
+	h.Subscribe(t, "math.subscribe.Counter", nil).Expect(1)
+}
+
+func TestNotifySubscribe(t *testing.T) {
+	h := newMathHarness(t)
+	raw := h.Raw(t)
+
+	raw.Send(`{"jsonrpc":"2.0","method":"math.subscribe.Counter"}`)
+	if msg := string(raw.Receive()); msg != `{"jsonrpc":"2.0","result":1,"id":"Counter"}` {
+		t.Fatalf("unexpected subscription message %s", msg)
+	}
+	raw.Send(`{"jsonrpc":"2.0","method":"math.unsubscribe.Counter"}`)
+	// Unsubscribe notification is not answered, next message is the response
+	if msg := string(raw.Roundtrip(`{"jsonrpc":"2.0","id":5,"method":"math.Add","params":[1,2]}`)); msg != `{"jsonrpc":"2.0","result":3,"id":5}` {
+		t.Fatalf("unexpected response %s", msg)
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	disconnected := make(chan *conn.Conn, 1)
+	h := newMathHarness(t, jrpc.WithOnDisconnect(func(c *conn.Conn, err error) {
+		disconnected <- c
+	}))
+	sub := h.Subscribe(t, "math.subscribe.Counter", nil)
+	sub.Expect(1)
+	h.Client.Close()
+
+	var c *conn.Conn
+	select {
+	case c = <-disconnected:
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("server did not notice closed connection")
+	}
+	deadline := time.Now().Add(jrpctest.DefaultTimeout)
+	for h.Server.Registry.HasSubscriptions(c.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription still running after connection was closed")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	select {
+	case <-sub.Sub.Done():
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("client subscription was not closed")
+	}
+	var closeErr conn.CloseError
+	if !errors.As(sub.Sub.Err(), &closeErr) {
+		t.Fatalf("unexpected subscription error %v", sub.Sub.Err())
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	h := newMathHarness(t, jrpc.WithPingPeriod(time.Millisecond*20), jrpc.WithIdleTimeout(time.Millisecond*50))
+	select {
+	case <-h.Client.Done():
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("idle connection was not closed")
+	}
+	var closeErr conn.CloseError
+	if err := h.Client.Conn.Err(); !errors.As(err, &closeErr) || closeErr.Reason != "idle timeout" {
+		t.Fatalf("unexpected close cause %v", err)
+	}
+}
+
+func TestIdleTimeoutKeepsSubscribedConnections(t *testing.T) {
+	h := newMathHarness(t, jrpc.WithPingPeriod(time.Millisecond*20), jrpc.WithIdleTimeout(time.Millisecond*50))
+	h.Subscribe(t, "math.subscribe.Counter", nil).Expect(1)
+	select {
+	case <-h.Client.Done():
+		t.Fatalf("subscribed connection was closed: %v", h.Client.Conn.Err())
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+// Service receiving notifications from the client
+type UI struct {
+	shown chan string
+}
+
+func (u UI) Show(text string) {
+	u.shown <- text
+}
+
+func TestNotificationCallIsNotAnswered(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui := UI{shown: make(chan string, 1)}
+	if err := s.Register("ui", ui); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("math", Math{}); err != nil {
+		t.Fatal(err)
+	}
+	raw := jrpctest.New(t, s).Raw(t)
+
+	raw.Send(`{"jsonrpc":"2.0","method":"ui.Show","params":["hello"]}`)
+	select {
+	case text := <-ui.shown:
+		if text != "hello" {
+			t.Fatalf("shown %q, expected %q", text, "hello")
+		}
+	case <-time.After(jrpctest.DefaultTimeout):
+		t.Fatal("notification was not executed")
+	}
+	// Notification is not answered, next message is the response
+	if msg := string(raw.Roundtrip(`{"jsonrpc":"2.0","id":1,"method":"math.Add","params":[1,2]}`)); msg != `{"jsonrpc":"2.0","result":3,"id":1}` {
+		t.Fatalf("unexpected response %s", msg)
+	}
+}
+
+func TestServerRequest(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("asker", Asker{}); err != nil {
+		t.Fatal(err)
+	}
+	raw := jrpctest.New(t, s).Raw(t)
+
+	raw.Send(`{"jsonrpc":"2.0","id":1,"method":"asker.Ask","params":["sure?"]}`)
+	id := receiveConfirm(t, raw)
+	if msg := string(raw.Roundtrip(fmt.Sprintf(`{"jsonrpc":"2.0","result":true,"id":%v}`, id))); msg != `{"jsonrpc":"2.0","result":true,"id":1}` {
+		t.Fatalf("unexpected response %s", msg)
+	}
+
+	// Error answered by the client is returned by conn.Request
+	raw.Send(`{"jsonrpc":"2.0","id":2,"method":"asker.Ask","params":["sure?"]}`)
+	id = receiveConfirm(t, raw)
+	msg := raw.Roundtrip(fmt.Sprintf(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"denied"},"id":%v}`, id))
+	var resp spec.Response
+	if err := spec.DefaultCodec.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("invalid response %s: %s", msg, err)
+	}
+	if resp.Error == nil || resp.Error.Code != spec.InternalErrorCode || resp.Error.Data != "denied" {
+		t.Fatalf("expected client error, got %s", msg)
+	}
+}
+
+func TestServerRequestTimeout(t *testing.T) {
+	s, err := jrpc.NewServer(jrpc.WithRequestTimeout(time.Millisecond * 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("asker", Asker{}); err != nil {
+		t.Fatal(err)
+	}
+	h := jrpctest.New(t, s)
+	raw := h.Raw(t)
+
+	// Request is never answered
+	raw.Send(`{"jsonrpc":"2.0","id":1,"method":"asker.Ask","params":["sure?"]}`)
+	receiveConfirm(t, raw)
+	msg := raw.Receive()
+	var resp spec.Response
+	if err := spec.DefaultCodec.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("invalid response %s: %s", msg, err)
+	}
+	if resp.Error == nil || resp.Error.Data != conn.ErrRequestTimeout.Error() {
+		t.Fatalf("expected request timeout, got %s", msg)
+	}
+}
+
+type Order struct {
+	ID       int    `json:"id"`
+	Customer string `json:"customer"`
+}
+
+// Delivers orders of the customer given in params or all orders without params
+func customerFilter(params, payload interface{}) bool {
+	customers, ok := params.([]interface{})
+	if !ok || len(customers) == 0 {
+		return true
+	}
+	order, ok := payload.(map[string]interface{})
+	return ok && order["customer"] == customers[0]
+}
+
+func TestPublish(t *testing.T) {
+	s, err := jrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterTopic("orders.updates", customerFilter); err != nil {
+		t.Fatal(err)
+	}
+	all, alice, bob := jrpctest.New(t, s), jrpctest.New(t, s), jrpctest.New(t, s)
+	allSub := all.Subscribe(t, "orders.subscribe.updates", nil).ExpectSubscribed()
+	aliceSub := alice.Subscribe(t, "orders.subscribe.updates", []string{"alice"}).ExpectSubscribed()
+	bobSub := bob.Subscribe(t, "orders.subscribe.updates", []string{"bob"}).ExpectSubscribed()
+
+	publish := func(order Order) {
+		t.Helper()
+		if err := s.Publish("orders.updates", order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(Order{ID: 1, Customer: "alice"})
+	publish(Order{ID: 2, Customer: "bob"})
+	allSub.Expect(Order{ID: 1, Customer: "alice"}).Expect(Order{ID: 2, Customer: "bob"})
+	aliceSub.Expect(Order{ID: 1, Customer: "alice"})
+	bobSub.Expect(Order{ID: 2, Customer: "bob"})
+
+	// Unsubscribed connection does not receive messages anymore
+	aliceSub.Unsubscribe()
+	publish(Order{ID: 3, Customer: "alice"})
+	allSub.Expect(Order{ID: 3, Customer: "alice"})
+	bobSub.ExpectNone(time.Millisecond * 50)
+
+	aliceSub = alice.Subscribe(t, "orders.subscribe.updates", []string{"alice"}).ExpectSubscribed()
+	publish(Order{ID: 4, Customer: "alice"})
+	aliceSub.Expect(Order{ID: 4, Customer: "alice"})
+	allSub.Expect(Order{ID: 4, Customer: "alice"})
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	s, err := jrpc.NewServer(jrpc.WithPingPeriod(time.Millisecond*20), jrpc.WithMaxMissedPongs(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.ServeConn(context.Background(), server)
+
+	// Client reads frames but never answers pings
+	client.SetReadDeadline(time.Now().Add(jrpctest.DefaultTimeout))
+	pings := 0
+	for {
+		frame, err := ws.ReadFrame(client)
+		if err != nil {
+			t.Fatalf("connection was not closed with close frame: %s", err)
+		}
+		switch frame.Header.OpCode {
+		case ws.OpPing:
+			pings++
+		case ws.OpClose:
+			code, reason := ws.ParseCloseFrameData(frame.Payload)
+			if code != ws.StatusGoingAway || reason != "heartbeat timeout" {
+				t.Fatalf("closed with %d %q", code, reason)
+			}
+			if pings == 0 {
+				t.Fatal("closed before any ping was sent")
+			}
+			return
+		}
+	}
+}
+
+func TestHeartbeatKeepsAnsweringConnections(t *testing.T) {
+	h := newMathHarness(t, jrpc.WithPingPeriod(time.Millisecond*20), jrpc.WithMaxMissedPongs(2))
+	select {
+	case <-h.Client.Done():
+		t.Fatalf("connection answering pings was closed: %v", h.Client.Conn.Err())
+	case <-time.After(time.Millisecond * 200):
+	}
+	h.Call(t, "math.Add", []int{1, 2}).Expect(3)
+}
@@ -0,0 +1,24 @@
+package spec
+
+import "encoding/json"
+
+// Codec encodes and decodes JsonRpc messages. Any implementation compatible
+// with encoding/json (i.e. jsoniter) can be used.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codec used when none is provided
+var DefaultCodec Codec = JSONCodec{}
+
+// Codec using standard library encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
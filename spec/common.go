@@ -46,7 +46,12 @@ func fromMap[T any](m interface{}) *T {
 	}
 */
 func Parse(data []byte) (interface{}, JrpcType) {
-	obj, tp := GetJrpcType(data)
+	return ParseCodec(DefaultCodec, data)
+}
+
+// The same as Parse but unmarshals data using provided codec
+func ParseCodec(codec Codec, data []byte) (interface{}, JrpcType) {
+	obj, tp := GetJrpcTypeCodec(codec, data)
 	var res interface{}
 	switch tp {
 	case TypeBatchRequest:
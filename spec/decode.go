@@ -2,7 +2,6 @@ package spec
 
 import (
 	"bytes"
-	"encoding/json"
 )
 
 // JrpcType represents all JsonRpc specification types
@@ -39,10 +38,15 @@ func JrpcTypeString(tp JrpcType) string {
 // Converts byte slice to JsonRpc and returns map[Object] and Type.
 // [Request, Response, Notification, Error, BatchRequest, BatchResponse, None]
 func GetJrpcType(data []byte) (interface{}, JrpcType) {
+	return GetJrpcTypeCodec(DefaultCodec, data)
+}
+
+// The same as GetJrpcType but unmarshals data using provided codec
+func GetJrpcTypeCodec(codec Codec, data []byte) (interface{}, JrpcType) {
 	switch GetJsonType(data) {
 	case TypeJsonArray:
 		array := []map[string]interface{}{}
-		if err := json.Unmarshal(data, &array); err != nil {
+		if err := codec.Unmarshal(data, &array); err != nil {
 			return nil, TypeNone
 		}
 		if len(array) > 0 {
@@ -55,7 +59,7 @@ func GetJrpcType(data []byte) (interface{}, JrpcType) {
 		}
 	case TypeJsonObject:
 		fieldMap := map[string]interface{}{}
-		if err := json.Unmarshal(data, &fieldMap); err != nil {
+		if err := codec.Unmarshal(data, &fieldMap); err != nil {
 			return nil, TypeNone
 		}
 		return fieldMap, getObjectType(fieldMap)
@@ -81,6 +85,10 @@ func getObjectType(fieldMap map[string]interface{}) JrpcType {
 			}
 		}
 	}
+	// Successful response with empty result is sent without result member
+	if _, hasId := fieldMap["id"]; hasId && fieldMap["jsonrpc"] == JsonRpcVersion {
+		return TypeResponse
+	}
 	return TypeNone
 }
 
@@ -32,6 +32,24 @@ func ParseError(data []byte) *Error {
 	return fromBytes[Error](data, TypeError)
 }
 
+// Data of RateLimitedCode error
+type RateLimitedData struct {
+	// Seconds to wait before retrying the call
+	RetryAfter float64 `json:"retryAfter"`
+}
+
+// Data of QuotaExceededCode error
+type QuotaExceededData struct {
+	// Cost of the rejected call
+	Cost int `json:"cost"`
+
+	// Cost remaining in the current window
+	Remaining int `json:"remaining"`
+
+	// Seconds after which some of the used cost is freed
+	ResetAfter float64 `json:"resetAfter"`
+}
+
 type ErrorCode int
 
 const (
@@ -40,6 +58,11 @@ const (
 	MethodNotFoundCode ErrorCode = -32601
 	InvalidParamsCode  ErrorCode = -32602
 	InternalErrorCode  ErrorCode = -32603
+
+	// Implementation defined server errors -32000 to -32099
+	ServerBusyCode    ErrorCode = -32000
+	RateLimitedCode   ErrorCode = -32005
+	QuotaExceededCode ErrorCode = -32006
 )
 
 type ErrorMsg string
@@ -51,6 +74,9 @@ const (
 	InvalidParamsMsg  ErrorMsg = "Invalid params"
 	InternalErrorMsg  ErrorMsg = "Internal error"
 	ServerErrorMsg    ErrorMsg = "Server error"
+	ServerBusyMsg     ErrorMsg = "Server busy"
+	RateLimitedMsg    ErrorMsg = "Rate limit exceeded"
+	QuotaExceededMsg  ErrorMsg = "Quota exceeded"
 )
 
 func ErrorMessage(code ErrorCode) ErrorMsg {
@@ -65,6 +91,12 @@ func ErrorMessage(code ErrorCode) ErrorMsg {
 		return InvalidParamsMsg
 	case InternalErrorCode:
 		return InternalErrorMsg
+	case ServerBusyCode:
+		return ServerBusyMsg
+	case RateLimitedCode:
+		return RateLimitedMsg
+	case QuotaExceededCode:
+		return QuotaExceededMsg
 	default:
 		return ServerErrorMsg
 	}
@@ -0,0 +1,115 @@
+package spec
+
+import (
+	"errors"
+)
+
+var (
+	ErrDepthLimit  = errors.New("json nesting depth exceeds the limit")
+	ErrParamsLimit = errors.New("params element count exceeds the limit")
+	ErrBatchLimit  = errors.New("batch length exceeds the limit")
+)
+
+// Limits for incoming messages. Zero value of a field means no limit.
+type Limits struct {
+	// Maximum nesting depth of json arrays and objects
+	MaxDepth int
+
+	// Maximum number of elements in params array or members in params object
+	MaxParams int
+
+	// Maximum number of requests in a batch
+	MaxBatch int
+}
+
+// Checks if any limit is set
+func (l Limits) IsZero() bool {
+	return l.MaxDepth == 0 && l.MaxParams == 0 && l.MaxBatch == 0
+}
+
+// Json container (array or object) being scanned
+type scanLevel struct {
+	obj    bool
+	count  int
+	params bool
+	key    []byte
+}
+
+// Scans raw json data and checks it against limits without decoding it.
+// Params are checked for the request object or for every request in a batch.
+// Invalid json is not reported here, it is left for the decoder.
+func CheckLimits(data []byte, l Limits) error {
+	if l.IsZero() {
+		return nil
+	}
+	stack := []*scanLevel{}
+	// Depth of request objects: 1 for a single request, 2 in a batch
+	reqDepth := 1
+	var prev byte
+	inString, escape, isKey := false, false, false
+	keyStart := 0
+	for i, c := range data {
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case c == '\\':
+				escape = true
+			case c == '"':
+				inString = false
+				if isKey {
+					stack[len(stack)-1].key = data[keyStart:i]
+				}
+				prev = c
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case ',', ':':
+			prev = c
+			continue
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			prev = c
+			continue
+		}
+
+		// Start of a value or an object key
+		isKey = false
+		if len(stack) > 0 && (prev == '[' || prev == '{' || prev == ',') {
+			top := stack[len(stack)-1]
+			top.count++
+			isKey = top.obj
+			if top.params && l.MaxParams > 0 && top.count > l.MaxParams {
+				return ErrParamsLimit
+			}
+			if len(stack) == 1 && !top.obj && l.MaxBatch > 0 && top.count > l.MaxBatch {
+				return ErrBatchLimit
+			}
+		}
+		switch c {
+		case '"':
+			inString = true
+			keyStart = i + 1
+		case '{', '[':
+			if len(stack) == 0 && c == '[' {
+				reqDepth = 2
+			}
+			params := false
+			if len(stack) == reqDepth && prev == ':' {
+				parent := stack[len(stack)-1]
+				params = parent.obj && string(parent.key) == "params"
+			}
+			stack = append(stack, &scanLevel{obj: c == '{', params: params})
+			if l.MaxDepth > 0 && len(stack) > l.MaxDepth {
+				return ErrDepthLimit
+			}
+		}
+		prev = c
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package spec
+
+import "testing"
+
+func TestCheckLimits(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxParams: 2, MaxBatch: 2}
+	tests := []struct {
+		name     string
+		data     string
+		limits   Limits
+		expected error
+	}{
+		{"no limits", `[[[[[[1]]]]]]`, Limits{}, nil},
+		{"request", `{"jsonrpc":"2.0","id":1,"method":"a.B","params":[1,2]}`, limits, nil},
+		{"params array", `{"jsonrpc":"2.0","id":1,"method":"a.B","params":[1,2,3]}`, limits, ErrParamsLimit},
+		{"params object", `{"jsonrpc":"2.0","id":1,"method":"a.B","params":{"x":1,"y":2,"z":3}}`, limits, ErrParamsLimit},
+		{"nested params are not counted", `{"method":"a.B","params":[[1,2,3],{"a":1,"b":2,"c":3}]}`, Limits{MaxParams: 2}, nil},
+		{"other members are not params", `{"method":"a.B","id":1,"jsonrpc":"2.0","extra":[1,2,3]}`, limits, nil},
+		{"params key in string", `{"method":"params","id":[1,2,3]}`, limits, nil},
+		{"escaped quote", `{"method":"a\"params","params":[1]}`, limits, nil},
+		{"depth", `{"method":"a.B","params":[[1]]}`, limits, nil},
+		{"too deep", `{"method":"a.B","params":[[[1]]]}`, limits, ErrDepthLimit},
+		{"brackets in string", `{"method":"a.B","params":["[[[[{{{{"]}`, limits, nil},
+		{"batch", `[{"method":"a.B","params":[1,2]},{"method":"a.B"}]`, limits, nil},
+		{"batch too long", `[{"method":"a.B"},{"method":"a.B"},{"method":"a.B"}]`, limits, ErrBatchLimit},
+		{"params in batch", `[{"method":"a.B","params":[1,2,3]}]`, limits, ErrParamsLimit},
+		{"invalid json", `{"method":`, limits, nil},
+	}
+	for _, test := range tests {
+		if err := CheckLimits([]byte(test.data), test.limits); err != test.expected {
+			t.Fatalf("%s: got %v, expected %v", test.name, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package jrpc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gobwas/ws"
+)
+
+var (
+	ErrOriginNotAllowed    = errors.New("origin not allowed")
+	ErrSubprotocolRequired = errors.New("none of required subprotocols requested")
+)
+
+// Checks upgrade request and upgrades it to websocket connection. Rejected
+// requests are answered with 403 Forbidden before hijacking the connection.
+// Negotiated subprotocol is returned with the connection.
+func (s *Server) upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, string, error) {
+	if err := s.checkOrigin(r); err != nil {
+		s.rejectUpgrade(w, r, http.StatusForbidden, err)
+		return nil, "", err
+	}
+	if len(s.Subprotocols) > 0 && selectProtocol(s.Subprotocols, requestedProtocols(r)) == "" {
+		s.rejectUpgrade(w, r, http.StatusForbidden, ErrSubprotocolRequired)
+		return nil, "", ErrSubprotocolRequired
+	}
+	cn, _, hs, err := s.upgrader(r).Upgrade(r, w)
+	if err != nil {
+		// Upgrader has already written the error response
+		s.Logger.Printf("upgrade error: %s", err)
+		if s.OnUpgradeReject != nil {
+			s.OnUpgradeReject(r, http.StatusBadRequest, err)
+		}
+		return nil, "", err
+	}
+	return cn, hs.Protocol, nil
+}
+
+// Returns copy of Upgrader with response headers and subprotocol
+// selection set from server settings
+func (s *Server) upgrader(r *http.Request) ws.HTTPUpgrader {
+	u := s.Upgrader
+	if len(s.ResponseHeader) > 0 {
+		header := http.Header{}
+		for k, v := range u.Header {
+			header[k] = v
+		}
+		for k, v := range s.ResponseHeader {
+			header[k] = v
+		}
+		u.Header = header
+	}
+	if len(s.Subprotocols) > 0 {
+		// Server order is preferred over the client order
+		selected := selectProtocol(s.Subprotocols, requestedProtocols(r))
+		u.Protocol = func(p string) bool {
+			return p == selected
+		}
+	}
+	return u
+}
+
+// Writes rejection response and calls OnUpgradeReject hook
+func (s *Server) rejectUpgrade(w http.ResponseWriter, r *http.Request, status int, err error) {
+	s.logf("upgrade rejected: %s origin=%q\n", err, r.Header.Get("Origin"))
+	if s.OnUpgradeReject != nil {
+		s.OnUpgradeReject(r, status, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// Checks Origin header of the upgrade request. Requests without Origin
+// (non-browser clients) are allowed. When AllowedOrigins is empty only the
+// same origin is allowed.
+func (s *Server) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return ErrOriginNotAllowed
+	}
+	if len(s.AllowedOrigins) == 0 {
+		if strings.EqualFold(u.Host, r.Host) {
+			return nil
+		}
+		return ErrOriginNotAllowed
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if matchOrigin(strings.ToLower(allowed), strings.ToLower(origin), strings.ToLower(u.Host)) {
+			return nil
+		}
+	}
+	return ErrOriginNotAllowed
+}
+
+// Matches origin against allowed pattern. Pattern is either "*", full origin
+// ("https://example.com") or host ("example.com"). Both can contain
+// wildcards, i.e. "https://*.example.com".
+func matchOrigin(pattern, origin, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if !strings.Contains(pattern, "://") {
+		origin = host
+	}
+	ok, err := path.Match(pattern, origin)
+	return err == nil && ok
+}
+
+// Returns subprotocols requested in Sec-WebSocket-Protocol headers
+func requestedProtocols(r *http.Request) []string {
+	protocols := []string{}
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	return protocols
+}
+
+// Returns first supported protocol that was requested, empty when none
+func selectProtocol(supported, requested []string) string {
+	for _, s := range supported {
+		for _, r := range requested {
+			if s == r {
+				return s
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package jrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/kroksys/jrpc/conn"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{nil, "", true},
+		{nil, "https://example.com", true},
+		{nil, "http://EXAMPLE.com", true},
+		{nil, "https://other.com", false},
+		{nil, "https://example.com.other.com", false},
+		{[]string{"https://example.com"}, "", true},
+		{[]string{"https://example.com"}, "https://example.com", true},
+		{[]string{"https://example.com"}, "http://example.com", false},
+		{[]string{"https://example.com"}, "https://other.com", false},
+		{[]string{"https://*.example.com"}, "https://api.example.com", true},
+		{[]string{"https://*.example.com"}, "https://example.com", false},
+		{[]string{"example.com"}, "http://EXAMPLE.com", true},
+		{[]string{"*"}, "https://other.com", true},
+	}
+	for _, test := range tests {
+		s, err := NewServer(WithAllowedOrigins(test.allowed...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if err := s.checkOrigin(r); (err == nil) != test.ok {
+			t.Fatalf("allowed %v, origin %q: got %v, expected allowed %v", test.allowed, test.origin, err, test.ok)
+		}
+	}
+}
+
+func TestSubprotocols(t *testing.T) {
+	tests := []struct {
+		supported []string
+		requested []string
+		selected  string
+		status    int
+	}{
+		{nil, nil, "", 0},
+		{nil, []string{"jsonrpc-2.0"}, "", 0},
+		{[]string{"jsonrpc-2.0"}, []string{"jsonrpc-2.0"}, "jsonrpc-2.0", 0},
+		{[]string{"v2", "v1"}, []string{"v1", "v2"}, "v2", 0},
+		{[]string{"v2", "v1"}, []string{"v0", "v1"}, "v1", 0},
+		{[]string{"jsonrpc-2.0"}, nil, "", http.StatusForbidden},
+		{[]string{"jsonrpc-2.0"}, []string{"other"}, "", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		connected := make(chan string, 1)
+		rejected := make(chan error, 1)
+		s, err := NewServer(
+			WithSubprotocols(test.supported...),
+			WithOnConnect(func(c *conn.Conn) { connected <- c.Protocol() }),
+			WithOnUpgradeReject(func(r *http.Request, status int, err error) { rejected <- err }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(http.HandlerFunc(s.WebsocketHandler))
+		url := "ws" + strings.TrimPrefix(srv.URL, "http")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		cn, _, hs, err := ws.Dialer{Protocols: test.requested}.Dial(ctx, url)
+		cancel()
+
+		if test.status != 0 {
+			var status ws.StatusError
+			if !errors.As(err, &status) || int(status) != test.status {
+				t.Fatalf("%v requested %v: got %v, expected status %d", test.supported, test.requested, err, test.status)
+			}
+			if err := <-rejected; !errors.Is(err, ErrSubprotocolRequired) {
+				t.Fatalf("%v requested %v: rejected with %v", test.supported, test.requested, err)
+			}
+			srv.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v requested %v: %s", test.supported, test.requested, err)
+		}
+		if hs.Protocol != test.selected {
+			t.Fatalf("%v requested %v: client got %q, expected %q", test.supported, test.requested, hs.Protocol, test.selected)
+		}
+		if got := <-connected; got != test.selected {
+			t.Fatalf("%v requested %v: server got %q, expected %q", test.supported, test.requested, got, test.selected)
+		}
+		cn.Close()
+		srv.Close()
+	}
+}